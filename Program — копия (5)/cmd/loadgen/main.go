@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"program/internal/loadgen"
+	requestsystem "program/internal/requestSystem"
+	"time"
+)
+
+func main() {
+	target := flag.String("url", "http://127.0.0.1:8081/", "адрес тестируемого сервиса")
+	method := flag.String("method", "GET", "HTTP-метод запросов")
+	configFile := flag.String("config", "", "JSON-конфигурация эксперимента: clients_num, lamb, arrival, client_arrivals, duration1")
+	timeout := flag.Duration("timeout", 5*time.Second, "ограничение времени одного запроса")
+	statsFile := flag.String("stats", "loadgen_stats.log", "файл статистики")
+	reportFile := flag.String("report", "loadgen_report.html", "HTML-отчет")
+	flag.Parse()
+
+	cfg := requestsystem.DefaultConfig()
+	if *configFile != "" {
+		data, err := os.ReadFile(*configFile)
+		if err != nil {
+			fmt.Println("Error reading config:", err)
+			os.Exit(1)
+		}
+		if err := json.Unmarshal(data, &cfg); err != nil {
+			fmt.Println("Error parsing config:", err)
+			os.Exit(1)
+		}
+	}
+
+	clients, err := cfg.NewClients()
+	if err != nil {
+		fmt.Println("Error creating clients:", err)
+		os.Exit(1)
+	}
+
+	statsManager, err := requestsystem.NewStatsManager(*statsFile, 0)
+	if err != nil {
+		fmt.Println("Error creating stats manager:", err)
+		os.Exit(1)
+	}
+	defer statsManager.Close()
+
+	lg, err := loadgen.New(loadgen.Config{
+		URL:      *target,
+		Method:   *method,
+		Duration: time.Duration(cfg.Duration1),
+		Timeout:  *timeout,
+		Clients:  clients,
+	}, statsManager)
+	if err != nil {
+		fmt.Println("Error creating load generator:", err)
+		os.Exit(1)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	lg.Run(ctx)
+
+	lg.ReportManager.GenerateSystemReport()
+	lg.ReportManager.GenerateClientReport()
+	if err := lg.ReportManager.GenerateHTMLReport(*reportFile); err != nil {
+		fmt.Println("Error creating HTML report:", err)
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"program/internal/proxy"
+	requestsystem "program/internal/requestSystem"
+	"syscall"
+	"time"
+)
+
+func main() {
+	listen := flag.String("listen", "127.0.0.1:8081", "адрес прокси")
+	upstream := flag.String("upstream", "http://127.0.0.1:8082", "адрес защищаемого сервиса")
+	workers := flag.Int("workers", 3, "количество специалистов, одновременно обращающихся к сервису")
+	bufferCap := flag.Int("buffer", 10, "емкость буфера")
+	timeout := flag.Duration("timeout", 5*time.Second, "ограничение времени запроса к сервису")
+	retryAfter := flag.Duration("retry-after", time.Second, "значение Retry-After для отклоненных запросов")
+	statsFile := flag.String("stats", "proxy_stats.log", "файл статистики")
+	drain := flag.Bool("drain", false, "при остановке дообработать запросы из буфера")
+	drainTimeout := flag.Duration("drain-timeout", 10*time.Second, "ограничение времени дообработки")
+	flag.Parse()
+
+	upstreamURL, err := url.Parse(*upstream)
+	if err != nil {
+		fmt.Println("Error parsing upstream:", err)
+		os.Exit(1)
+	}
+
+	p, err := proxy.New(proxy.Config{
+		Upstream:   upstreamURL,
+		Workers:    *workers,
+		BufferCap:  *bufferCap,
+		Timeout:    *timeout,
+		RetryAfter: *retryAfter,
+		StatsFile:  *statsFile,
+
+		Drain:        *drain,
+		DrainTimeout: *drainTimeout,
+	})
+	if err != nil {
+		fmt.Println("Error creating proxy:", err)
+		os.Exit(1)
+	}
+	defer p.Pool.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	p.Start(ctx)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /metrics", func(w http.ResponseWriter, r *http.Request) {
+		mw := requestsystem.NewMetricsWriter()
+		p.Pool.CollectMetrics(mw, nil)
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		mw.WriteTo(w)
+	})
+	mux.Handle("/", p)
+	httpServer := &http.Server{Addr: *listen, Handler: mux}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		httpServer.Shutdown(shutdownCtx)
+	}()
+
+	fmt.Println("Proxying", *listen, "to", upstreamURL)
+	if err := httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		fmt.Println("Error starting proxy:", err)
+	}
+
+	p.Stop()
+	p.Pool.ReportManager.GenerateSpecialistReport(p.Pool.Specialists, p.Pool.CreatedAtTimes)
+	p.Pool.ReportManager.GenerateSystemReport()
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"program/internal/server"
+	"time"
+)
+
+func main() {
+	addr := flag.String("addr", "127.0.0.1:8080", "адрес HTTP API")
+	dir := flag.String("dir", "runs", "каталог для файлов экспериментов")
+	flag.Parse()
+
+	srv := server.New(*dir)
+	httpServer := &http.Server{Addr: *addr, Handler: srv.Handler()}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		httpServer.Shutdown(shutdownCtx)
+	}()
+
+	fmt.Println("Listening on", *addr)
+	if err := httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		fmt.Println("Error starting server:", err)
+		os.Exit(1)
+	}
+
+	// Останавливаем незавершенные эксперименты, чтобы сохранить их отчеты
+	srv.Shutdown()
+}
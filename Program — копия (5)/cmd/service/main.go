@@ -1,29 +1,28 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"fmt"
+	"net/http"
 	"os"
+	"os/signal"
 	requestsystem "program/internal/requestSystem"
-	"strconv"
-	"sync"
+	"syscall"
 	"time"
 )
 
 func main() {
-	lamb := 200.0    //8.5     // ms время равномерной генерации заявок. от 5 до 9 мс
-	lamb_ex := 1.901 // коэфф для експ распределения времени работы. 3 - норм, 5 - быстро
-	lamb_ex2 := 1.005
+	metricsAddr := flag.String("metrics", "", "адрес для публикации метрик Prometheus, например 127.0.0.1:9100")
+	drain := flag.Bool("drain", false, "при остановке дообработать заявки из буфера")
+	drainTimeout := flag.Duration("drain-timeout", 10*time.Second, "ограничение времени дообработки")
+	flag.Parse()
 
-	duration1 := 30 * time.Second // Устанавливаем время работы генератора и процессора
-	duration2 := 60 * time.Second
-
-	pause_gen := 100 * time.Millisecond
-	pause_proc := 100 * time.Millisecond
-
-	clients_num := 20
-	specs_num1 := 2
-	specs_num2 := 1
-	buffer_cap := 10
+	// lamb - ms время равномерной генерации заявок, lamb_ex - коэфф для експ распределения времени работы
+	// (3 - норм, 5 - быстро), duration1/duration2 - время работы генератора и процессора
+	cfg := requestsystem.DefaultConfig()
+	cfg.Drain = *drain
+	cfg.DrainTimeout = requestsystem.Duration(*drainTimeout)
 
 	// Создаем файл для вывода в консоль
 	consoleLogFile, err := os.Create("console.log")
@@ -37,79 +36,43 @@ func main() {
 	oldStdout := os.Stdout
 	os.Stdout = consoleLogFile
 
-	// Создаем несколько клиентов
-	clients := []*requestsystem.Client{}
-
-	for i := 1; i <= clients_num; i++ {
-		client := &requestsystem.Client{ID: strconv.Itoa(i)}
-		clients = append(clients, client)
-	}
-
-	// Создаем буфер с емкостью 10
-	buffer := requestsystem.NewBuffer(buffer_cap)
-
-	specialists := []*requestsystem.Specialist{}
-	createdAtTimes := []time.Time{}
-
-	// Создаем специалистов в цикле и добавляем их в список
-	for i := 1; i <= specs_num1; i++ {
-		specialist := &requestsystem.Specialist{Available: true, Id: i, Lambda: lamb_ex, CreatedAt: time.Now()}
-		specialists = append(specialists, specialist)
-		createdAtTimes = append(createdAtTimes, specialist.CreatedAt)
-	}
-	for i := specs_num1 + 1; i <= specs_num1+specs_num2; i++ {
-		specialist := &requestsystem.Specialist{Available: true, Id: i, Lambda: lamb_ex2, CreatedAt: time.Now()}
-		specialists = append(specialists, specialist)
-		createdAtTimes = append(createdAtTimes, specialist.CreatedAt)
-	}
-
-	retrievalManager := &requestsystem.RetrievalManager{
-		Buffer:      buffer,
-		Specialists: specialists,
-	}
-
-	stagingManager := &requestsystem.StagingManager{Buffer: buffer}
-
-	// Создаем StatsManager
-	statsManager, err := requestsystem.NewStatsManager("stats1.log", specs_num1+specs_num2)
+	// Создаем клиентов, буфер, специалистов и менеджеров
+	sim, err := requestsystem.NewSimulation(cfg)
 	if err != nil {
-		fmt.Println("Error creating stats manager:", err)
+		fmt.Println("Error creating simulation:", err)
 		return
 	}
-	defer statsManager.Close()
-
-	reportManager := requestsystem.NewReportManager(statsManager)
-
-	// Создаем WaitGroup для ожидания завершения горутин
-	var wg sync.WaitGroup
-
-	// Запускаем горутину для генерации заявок
-	wg.Add(1)
-	requestsystem.StartRequestGeneration(clients, stagingManager, retrievalManager, &wg, lamb, statsManager, duration1, pause_gen)
+	defer sim.Close()
+	sim.Console = os.Stdout
 
-	// Запускаем горутину для обработки заявок
-	wg.Add(1)
-	requestsystem.StartRequestProcessing(retrievalManager, &wg, statsManager, duration2, pause_proc)
-
-	// Логируем статистику каждые 100 мс
-	go func() {
-		for {
-			time.Sleep(10 * time.Millisecond)
-			statsManager.RecordWorkTime(10 * time.Millisecond)
-			statsManager.LogStatistics(len(retrievalManager.Specialists), createdAtTimes)
-		}
-	}()
+	if *metricsAddr != "" {
+		go serveMetrics(*metricsAddr, sim)
+	}
 
-	// Ожидаем завершения всех горутин
-	wg.Wait()
+	// При SIGINT/SIGTERM останавливаем моделирование досрочно, отчеты все равно формируются
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	// Логируем статистику после завершения работы
-	statsManager.LogStatistics(len(retrievalManager.Specialists), createdAtTimes)
+	// Запускаем генерацию и обработку заявок и ожидаем их завершения
+	sim.Run(ctx)
 
 	// Генерируем отчеты
-	reportManager.GenerateSpecialistReport(specialists, createdAtTimes)
-	reportManager.GenerateSystemReport()
+	sim.GenerateReports(".")
 
 	// Возвращаем стандартный вывод в консоль
 	os.Stdout = oldStdout
 }
+
+// serveMetrics publishes the metrics of the simulation on /metrics.
+func serveMetrics(addr string, sim *requestsystem.Simulation) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /metrics", func(w http.ResponseWriter, r *http.Request) {
+		mw := requestsystem.NewMetricsWriter()
+		sim.CollectMetrics(mw, nil)
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		mw.WriteTo(w)
+	})
+	if err := http.ListenAndServe(addr, mux); err != nil {
+		fmt.Fprintln(os.Stderr, "Error serving metrics:", err)
+	}
+}
@@ -0,0 +1,153 @@
+package loadgen
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	requestsystem "program/internal/requestSystem"
+	"sync"
+	"time"
+)
+
+// Config describes an open-loop load test against an HTTP target.
+type Config struct {
+	URL      string
+	Method   string
+	Duration time.Duration // Время генерации запросов
+	Timeout  time.Duration // Ограничение времени одного запроса
+	Clients  []*requestsystem.Client
+}
+
+// LoadGenerator sends HTTP requests with the inter-arrival distributions of the clients and records
+// the measured behaviour of the target into the same StatsManager tables as the simulation.
+// A response with status 503 counts as a rejection, transport errors and 5xx as failed requests.
+type LoadGenerator struct {
+	Config        Config
+	StatsManager  *requestsystem.StatsManager
+	ReportManager *requestsystem.ReportManager
+
+	httpClient *http.Client
+	inFlight   sync.WaitGroup
+}
+
+// New creates a load generator that writes its statistics to statsManager.
+func New(cfg Config, statsManager *requestsystem.StatsManager) (*LoadGenerator, error) {
+	if cfg.URL == "" {
+		return nil, fmt.Errorf("url is required")
+	}
+	if len(cfg.Clients) == 0 {
+		return nil, fmt.Errorf("at least one client is required")
+	}
+	for _, client := range cfg.Clients {
+		if client.Arrival == nil {
+			return nil, fmt.Errorf("client %s has no arrival distribution", client.ID)
+		}
+	}
+	if cfg.Method == "" {
+		cfg.Method = http.MethodGet
+	}
+
+	return &LoadGenerator{
+		Config:        cfg,
+		StatsManager:  statsManager,
+		ReportManager: requestsystem.NewReportManager(statsManager),
+		httpClient: &http.Client{
+			Transport: &http.Transport{MaxIdleConnsPerHost: 100},
+		},
+	}, nil
+}
+
+// Run generates requests of every client in its own goroutine until Duration passes or ctx is cancelled,
+// then waits for the requests in flight. Statistics are logged while the test runs.
+func (lg *LoadGenerator) Run(ctx context.Context) {
+	logCtx, stopLogging := context.WithCancel(context.Background())
+	loggerDone := make(chan struct{})
+	go func() {
+		defer close(loggerDone)
+		requestsystem.RunStatsLogger(logCtx, lg.StatsManager, nil, nil, nil)
+	}()
+	defer func() {
+		stopLogging()
+		<-loggerDone
+		lg.StatsManager.Flush(0, nil)
+	}()
+
+	ctx, cancel := context.WithTimeout(ctx, lg.Config.Duration)
+	defer cancel()
+
+	var generators sync.WaitGroup
+	for _, client := range lg.Config.Clients {
+		generators.Add(1)
+		go func() {
+			defer generators.Done()
+			lg.generate(ctx, client)
+		}()
+	}
+	generators.Wait()
+	lg.inFlight.Wait()
+}
+
+// generate sends requests of the client without waiting for the previous responses (open loop).
+func (lg *LoadGenerator) generate(ctx context.Context, client *requestsystem.Client) {
+	for {
+		timer := time.NewTimer(client.Arrival.Sample())
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		request := client.SubmitRequest("HTTP")
+		lg.StatsManager.RecordRequest(request)
+
+		lg.inFlight.Add(1)
+		go func() {
+			defer lg.inFlight.Done()
+			lg.send(request)
+		}()
+	}
+}
+
+// send performs the request and records its latency and outcome.
+func (lg *LoadGenerator) send(request *requestsystem.Request) {
+	ctx := context.Background()
+	if lg.Config.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, lg.Config.Timeout)
+		defer cancel()
+	}
+
+	httpRequest, err := http.NewRequestWithContext(ctx, lg.Config.Method, lg.Config.URL, nil)
+	if err != nil {
+		lg.StatsManager.RecordCompletedRequest(request, err)
+		return
+	}
+	httpRequest.Header.Set(requestsystem.ClientHeader, request.Client.ID)
+
+	start := time.Now()
+	response, err := lg.httpClient.Do(httpRequest)
+	if err == nil {
+		_, err = io.Copy(io.Discard, response.Body)
+		response.Body.Close()
+	}
+	latency := time.Since(start)
+
+	switch {
+	case err != nil:
+		request.UpdateStatus("Failed")
+	case response.StatusCode == http.StatusServiceUnavailable:
+		request.UpdateStatus("Rejected")
+		lg.StatsManager.RecordRejectedRequest(request)
+		return
+	case response.StatusCode >= 500:
+		request.UpdateStatus("Failed")
+		err = fmt.Errorf("status %s", response.Status)
+	default:
+		request.UpdateStatus("Completed")
+	}
+
+	lg.StatsManager.RecordProcessingTime(request, latency)
+	lg.StatsManager.RecordCompletedRequest(request, err)
+}
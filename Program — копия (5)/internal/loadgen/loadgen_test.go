@@ -0,0 +1,88 @@
+package loadgen
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	requestsystem "program/internal/requestSystem"
+	"testing"
+	"time"
+)
+
+const (
+	latency = 20 * time.Millisecond  // Время ответа цели на обычный запрос
+	timeout = 100 * time.Millisecond // Ограничение времени запроса генератора
+)
+
+// newTestTarget serves requests by the ID of the client: "ok" answers after latency, "broken" with 500,
+// "busy" with 503 and "slow" only after the request of the generator times out.
+func newTestTarget(t *testing.T) *httptest.Server {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Header.Get(requestsystem.ClientHeader) {
+		case "ok":
+			time.Sleep(latency)
+		case "broken":
+			w.WriteHeader(http.StatusInternalServerError)
+		case "busy":
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case "slow":
+			<-r.Context().Done()
+		}
+	}))
+	t.Cleanup(target.Close)
+	return target
+}
+
+func TestSendRecordsOutcomes(t *testing.T) {
+	target := newTestTarget(t)
+	sm, err := requestsystem.NewStatsManager(filepath.Join(t.TempDir(), "stats.log"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(sm.Close)
+
+	var clients []*requestsystem.Client
+	for _, id := range []string{"ok", "broken", "busy", "slow"} {
+		clients = append(clients, &requestsystem.Client{ID: id, Arrival: requestsystem.Constant{Value: time.Hour}})
+	}
+	lg, err := New(Config{URL: target.URL, Timeout: timeout, Clients: clients}, sm)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, client := range clients {
+		request := client.SubmitRequest("HTTP")
+		sm.RecordRequest(request)
+		lg.send(request)
+	}
+
+	snapshot := sm.Snapshot()
+	counts := []struct {
+		name      string
+		got, want int
+	}{
+		{"TotalRequests", snapshot.TotalRequests, 4},
+		{"CompletedRequests", snapshot.CompletedRequests, 3},
+		{"FailedRequests", snapshot.FailedRequests, 2},
+		{"RejectedRequests", snapshot.RejectedRequests, 1},
+		{"TimedOutRequests", snapshot.TimedOutRequests, 1},
+		{"ok Failed", snapshot.ClientStats["ok"].Failed, 0},
+		{"broken Failed", snapshot.ClientStats["broken"].Failed, 1},
+		{"busy Rejected", snapshot.ClientStats["busy"].Rejected, 1},
+		{"busy Completed", snapshot.ClientStats["busy"].Completed, 0},
+		{"slow Failed", snapshot.ClientStats["slow"].Failed, 1},
+	}
+	for _, c := range counts {
+		if c.got != c.want {
+			t.Errorf("%s = %d, want %d", c.name, c.got, c.want)
+		}
+	}
+
+	// Задержка измеряется от отправки до конца ответа; у запроса с таймаутом - до отмены
+	if got := snapshot.ClientStats["ok"].ResponseTime; got < latency {
+		t.Errorf("response time of ok = %v, want at least %v", got, latency)
+	}
+	if got := snapshot.TotalProcessingTime; got < latency+timeout {
+		t.Errorf("TotalProcessingTime = %v, want at least %v", got, latency+timeout)
+	}
+}
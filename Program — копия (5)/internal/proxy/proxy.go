@@ -0,0 +1,194 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	requestsystem "program/internal/requestSystem"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ClientHeader is the header that identifies the client of a proxied request.
+// Without it the client is identified by the remote host.
+const ClientHeader = requestsystem.ClientHeader
+
+// Состояния запроса, ожидающего обработки
+const (
+	stateWaiting int32 = iota
+	stateServing
+	stateRejected
+	stateAbandoned
+)
+
+// Config describes the admission-control proxy.
+type Config struct {
+	Upstream   *url.URL
+	Workers    int
+	BufferCap  int
+	Timeout    time.Duration // Ограничение времени запроса к upstream
+	RetryAfter time.Duration // Значение заголовка Retry-After для отклоненных запросов
+	StatsFile  string
+
+	Drain        bool          // При остановке дообработать запросы из буфера
+	DrainTimeout time.Duration // Ограничение времени дообработки
+}
+
+// exchange is the payload of a proxied request: the HTTP request and the way to answer it.
+type exchange struct {
+	w        http.ResponseWriter
+	r        *http.Request
+	state    atomic.Int32
+	rejected chan struct{}
+	done     chan struct{}
+	err      error
+}
+
+// Proxy admits incoming HTTP requests through the bounded Buffer and forwards them to the upstream
+// with a fixed pool of specialists. Requests displaced from the full buffer get 503 with Retry-After.
+type Proxy struct {
+	Pool       *requestsystem.WorkerPool
+	RetryAfter time.Duration
+
+	reverse *httputil.ReverseProxy
+	clients map[string]*requestsystem.Client
+	mu      sync.Mutex
+}
+
+// New creates the proxy and its worker pool. The pool is started with Start.
+func New(cfg Config) (*Proxy, error) {
+	if cfg.Upstream == nil {
+		return nil, fmt.Errorf("upstream is required")
+	}
+	if cfg.RetryAfter <= 0 {
+		cfg.RetryAfter = time.Second
+	}
+
+	p := &Proxy{
+		RetryAfter: cfg.RetryAfter,
+		clients:    make(map[string]*requestsystem.Client),
+	}
+	p.reverse = httputil.NewSingleHostReverseProxy(cfg.Upstream)
+	p.reverse.ErrorHandler = p.upstreamError
+
+	pool, err := requestsystem.NewWorkerPool(requestsystem.WorkerPoolConfig{
+		Workers:   cfg.Workers,
+		BufferCap: cfg.BufferCap,
+		Handler:   p.forward,
+		Timeout:   cfg.Timeout,
+		StatsFile: cfg.StatsFile,
+
+		Drain:        cfg.Drain,
+		DrainTimeout: cfg.DrainTimeout,
+	})
+	if err != nil {
+		return nil, err
+	}
+	pool.OnReject = p.reject
+	p.Pool = pool
+
+	return p, nil
+}
+
+// Start starts the worker pool.
+func (p *Proxy) Start(ctx context.Context) {
+	p.Pool.Start(ctx)
+}
+
+// Stop stops the worker pool. With Drain the buffered requests are forwarded first,
+// the requests still waiting in the buffer are rejected.
+func (p *Proxy) Stop() {
+	p.Pool.Stop()
+}
+
+// ServeHTTP places the request in the pool and waits until a specialist forwards it or it is rejected.
+func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ex := &exchange{
+		w:        w,
+		r:        r,
+		rejected: make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	p.Pool.Submit(p.client(r), ex)
+
+	select {
+	case <-ex.done:
+	case <-ex.rejected:
+		w.Header().Set("Retry-After", strconv.Itoa(int((p.RetryAfter+time.Second-1)/time.Second)))
+		http.Error(w, "service is overloaded", http.StatusServiceUnavailable)
+	case <-r.Context().Done():
+		// Клиент ушел. Если специалист уже начал пересылку, дожидаемся ее окончания,
+		// иначе специалист пропустит запрос
+		if !ex.state.CompareAndSwap(stateWaiting, stateAbandoned) {
+			select {
+			case <-ex.done:
+			case <-ex.rejected:
+			}
+		}
+	}
+}
+
+// client returns the client of the request, creating it on first use.
+func (p *Proxy) client(r *http.Request) *requestsystem.Client {
+	id := r.Header.Get(ClientHeader)
+	if id == "" {
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			host = r.RemoteAddr
+		}
+		id = host
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	client, ok := p.clients[id]
+	if !ok {
+		client = &requestsystem.Client{ID: id}
+		p.clients[id] = client
+	}
+	return client
+}
+
+// forward is the specialists' handler: it sends the request to the upstream.
+func (p *Proxy) forward(ctx context.Context, request *requestsystem.Request) error {
+	ex := request.Payload.(*exchange)
+	if !ex.state.CompareAndSwap(stateWaiting, stateServing) {
+		return context.Canceled
+	}
+	defer close(ex.done)
+
+	p.reverse.ServeHTTP(ex.w, ex.r.WithContext(withExchange(ctx, ex)))
+	return ex.err
+}
+
+// reject answers a request displaced from the buffer.
+func (p *Proxy) reject(request *requestsystem.Request) {
+	ex := request.Payload.(*exchange)
+	if ex.state.CompareAndSwap(stateWaiting, stateRejected) {
+		close(ex.rejected)
+	}
+}
+
+// upstreamError records the error of the upstream and answers 504 on timeout and 502 otherwise.
+func (p *Proxy) upstreamError(w http.ResponseWriter, r *http.Request, err error) {
+	if ex, ok := r.Context().Value(exchangeKey{}).(*exchange); ok {
+		ex.err = err
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		http.Error(w, "upstream timeout", http.StatusGatewayTimeout)
+		return
+	}
+	http.Error(w, "upstream error", http.StatusBadGateway)
+}
+
+type exchangeKey struct{}
+
+func withExchange(ctx context.Context, ex *exchange) context.Context {
+	return context.WithValue(ctx, exchangeKey{}, ex)
+}
@@ -0,0 +1,192 @@
+package proxy
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	requestsystem "program/internal/requestSystem"
+	"testing"
+	"time"
+)
+
+// testBackend is an upstream whose requests wait until release is closed.
+type testBackend struct {
+	*httptest.Server
+	started chan string   // ID клиента каждого запроса, дошедшего до upstream
+	release chan struct{} // Закрывается, чтобы upstream ответил
+}
+
+func newTestBackend(t *testing.T) *testBackend {
+	b := &testBackend{started: make(chan string, 16), release: make(chan struct{})}
+	b.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(ClientHeader)
+		b.started <- id
+		select {
+		case <-b.release:
+		case <-r.Context().Done():
+			return
+		}
+		io.WriteString(w, id)
+	}))
+	t.Cleanup(b.Close)
+	return b
+}
+
+// newTestProxy starts a proxy with one worker and a buffer of one request in front of the backend.
+func newTestProxy(t *testing.T, backend *testBackend) (*Proxy, *httptest.Server) {
+	upstream, err := url.Parse(backend.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := New(Config{
+		Upstream:  upstream,
+		Workers:   1,
+		BufferCap: 1,
+		StatsFile: filepath.Join(t.TempDir(), "stats.log"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Start(context.Background())
+	front := httptest.NewServer(p)
+	t.Cleanup(func() {
+		front.Close()
+		p.Stop()
+		p.Pool.Close()
+	})
+	return p, front
+}
+
+// response is the result of a request through the proxy.
+type response struct {
+	status     int
+	body       string
+	retryAfter string
+}
+
+// send sends a request of the client through the proxy in the background.
+func send(t *testing.T, front *httptest.Server, clientID string) <-chan response {
+	result := make(chan response, 1)
+	go func() {
+		req, err := http.NewRequest(http.MethodGet, front.URL, nil)
+		if err != nil {
+			t.Error(err)
+			result <- response{}
+			return
+		}
+		req.Header.Set(ClientHeader, clientID)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Error(err)
+			result <- response{}
+			return
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		result <- response{status: resp.StatusCode, body: string(body), retryAfter: resp.Header.Get("Retry-After")}
+	}()
+	return result
+}
+
+// waitBuffered waits until the buffer of the proxy holds n requests.
+func waitBuffered(t *testing.T, p *Proxy, n int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for p.Pool.Buffer.Len() != n {
+		if time.Now().After(deadline) {
+			t.Fatalf("buffer holds %d requests, want %d", p.Pool.Buffer.Len(), n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// occupy sends a request of the client and waits until the only worker forwards it.
+func occupy(t *testing.T, backend *testBackend, front *httptest.Server, clientID string) <-chan response {
+	t.Helper()
+	result := send(t, front, clientID)
+	if id := <-backend.started; id != clientID {
+		t.Fatalf("upstream got a request of client %q, want %q", id, clientID)
+	}
+	return result
+}
+
+func TestProxyForwardsWithClientHeader(t *testing.T) {
+	backend := newTestBackend(t)
+	close(backend.release)
+	_, front := newTestProxy(t, backend)
+
+	resp := <-send(t, front, "alice")
+	if resp.status != http.StatusOK || resp.body != "alice" {
+		t.Errorf("got %d %q, want 200 %q", resp.status, resp.body, "alice")
+	}
+}
+
+func TestProxyRejectsWhenBufferIsFull(t *testing.T) {
+	backend := newTestBackend(t)
+	p, front := newTestProxy(t, backend)
+
+	first := occupy(t, backend, front, "a")
+	displaced := send(t, front, "b")
+	waitBuffered(t, p, 1)
+	// Новый запрос вытесняет из полного буфера последний
+	last := send(t, front, "c")
+
+	resp := <-displaced
+	if resp.status != http.StatusServiceUnavailable || resp.retryAfter != "1" {
+		t.Errorf("displaced request got %d with Retry-After %q, want 503 with 1", resp.status, resp.retryAfter)
+	}
+
+	close(backend.release)
+	for _, result := range []<-chan response{first, last} {
+		if resp := <-result; resp.status != http.StatusOK {
+			t.Errorf("got %d, want 200", resp.status)
+		}
+	}
+	if got := p.Pool.StatsManager.Snapshot().RejectedRequests; got != 1 {
+		t.Errorf("RejectedRequests = %d, want 1", got)
+	}
+}
+
+func TestProxyRejectsWhenClientBalks(t *testing.T) {
+	backend := newTestBackend(t)
+	p, front := newTestProxy(t, backend)
+	p.clients["picky"] = &requestsystem.Client{
+		ID:      "picky",
+		Balking: requestsystem.BalkingFunc(func(state requestsystem.QueueState) bool { return true }),
+	}
+
+	first := occupy(t, backend, front, "a")
+	if resp := <-send(t, front, "picky"); resp.status != http.StatusServiceUnavailable {
+		t.Errorf("balked request got %d, want 503", resp.status)
+	}
+
+	close(backend.release)
+	if resp := <-first; resp.status != http.StatusOK {
+		t.Errorf("got %d, want 200", resp.status)
+	}
+	if got := p.Pool.StatsManager.Snapshot().BalkedRequests; got != 1 {
+		t.Errorf("BalkedRequests = %d, want 1", got)
+	}
+}
+
+func TestProxyStopRejectsBuffered(t *testing.T) {
+	backend := newTestBackend(t)
+	p, front := newTestProxy(t, backend)
+
+	first := occupy(t, backend, front, "a")
+	buffered := send(t, front, "b")
+	waitBuffered(t, p, 1)
+
+	p.Stop()
+
+	if resp := <-buffered; resp.status != http.StatusServiceUnavailable {
+		t.Errorf("buffered request got %d, want 503", resp.status)
+	}
+	// Пересылка, прерванная остановкой, завершается ошибкой upstream
+	if resp := <-first; resp.status != http.StatusBadGateway {
+		t.Errorf("interrupted request got %d, want 502", resp.status)
+	}
+}
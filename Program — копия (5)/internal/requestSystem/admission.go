@@ -0,0 +1,299 @@
+package requestsystem
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// RateLimiter limits how many requests of a client enter the system over time.
+type RateLimiter interface {
+	// Reserve takes a place for a request arriving at now and returns the delay after which it may enter.
+	// A request that would have to wait longer than maxDelay gets no place and ok is false.
+	Reserve(now time.Time, maxDelay time.Duration) (delay time.Duration, ok bool)
+}
+
+// TokenBucket lets in Rate requests per second on average and up to Burst requests at once.
+// Places reserved for delayed requests are paid back by the tokens that come later.
+type TokenBucket struct {
+	Rate  float64 // Токенов в секунду
+	Burst int     // Емкость корзины
+
+	tokens float64 // Отрицательное значение - места, уже обещанные отложенным заявкам
+	last   time.Time
+	mu     sync.Mutex
+}
+
+// Reserve takes a token, waiting for it up to maxDelay.
+func (b *TokenBucket) Reserve(now time.Time, maxDelay time.Duration) (time.Duration, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.last.IsZero() {
+		// Корзина начинает заполненной
+		b.tokens, b.last = float64(b.Burst), now
+	}
+	if now.After(b.last) {
+		b.tokens = math.Min(float64(b.Burst), b.tokens+now.Sub(b.last).Seconds()*b.Rate)
+		b.last = now
+	}
+
+	tokens := b.tokens - 1
+	var delay time.Duration
+	if tokens < 0 {
+		delay = time.Duration(-tokens / b.Rate * float64(time.Second))
+	}
+	if delay > maxDelay {
+		return delay, false
+	}
+	b.tokens = tokens
+	return delay, true
+}
+
+// SlidingWindow lets in at most Limit requests during any Window.
+type SlidingWindow struct {
+	Limit  int
+	Window time.Duration
+
+	times []time.Time // Моменты допуска последних заявок по возрастанию, в том числе будущие для отложенных
+	mu    sync.Mutex
+}
+
+// Reserve takes a place in the window, waiting for it up to maxDelay.
+func (w *SlidingWindow) Reserve(now time.Time, maxDelay time.Duration) (time.Duration, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	// Забываем допуски, вышедшие из окна
+	for len(w.times) > 0 && !w.times[0].After(now.Add(-w.Window)) {
+		w.times = w.times[1:]
+	}
+
+	at := now
+	if len(w.times) >= w.Limit {
+		// Заявка входит, когда из окна выходит заявка, допущенная Limit допусков назад
+		at = w.times[len(w.times)-w.Limit].Add(w.Window)
+	}
+	if n := len(w.times); n > 0 && at.Before(w.times[n-1]) {
+		at = w.times[n-1]
+	}
+	if at.Before(now) {
+		at = now
+	}
+
+	delay := at.Sub(now)
+	if delay > maxDelay {
+		return delay, false
+	}
+	w.times = append(w.times, at)
+	return delay, true
+}
+
+// Admission lets the requests of clients into the system within their rate limits.
+// A request over the limit is throttled or, if its client may wait up to MaxDelay, held
+// until the limit lets it in and then placed by Place.
+type Admission struct {
+	Limiters     map[string]RateLimiter // Ограничитель клиента по ID; заявки клиента без ограничителя допускаются всегда
+	MaxDelay     time.Duration          // Сколько заявка может ждать допуска; 0 - заявка сверх лимита сразу отклоняется
+	Place        func(request *Request) // Размещает допущенную отложенную заявку
+	StatsManager *StatsManager          // Статистика отклоненных и отложенных заявок, может быть nil
+	Events       *EventBus
+
+	held   map[*Request]*time.Timer
+	closed bool
+	mu     sync.Mutex
+}
+
+// AdmitDecision is the decision of the admission control on a new request.
+type AdmitDecision int
+
+// Решения о допуске заявки
+const (
+	AdmitNow       AdmitDecision = iota // Заявка размещается сразу
+	AdmitHeld                           // Заявка ждет допуска и размещается позже через Place
+	AdmitThrottled                      // Заявка отклонена лимитом клиента
+)
+
+// Admit decides on a new request. A held request is placed later, a throttled one has left the system.
+// A nil admission lets every request in.
+func (a *Admission) Admit(request *Request) AdmitDecision {
+	if a == nil {
+		return AdmitNow
+	}
+	limiter, ok := a.Limiters[request.Client.ID]
+	if !ok {
+		return AdmitNow
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.closed {
+		a.throttle(request)
+		return AdmitThrottled
+	}
+	delay, ok := limiter.Reserve(time.Now(), a.MaxDelay)
+	if !ok {
+		a.throttle(request)
+		return AdmitThrottled
+	}
+	if delay == 0 {
+		return AdmitNow
+	}
+
+	a.held[request] = time.AfterFunc(delay, func() { a.release(request) })
+	if a.StatsManager != nil {
+		a.StatsManager.RecordDelayedRequest(request, delay)
+	}
+	a.Events.Publish(newRequestEvent(EventDelayed, request, 0))
+	return AdmitHeld
+}
+
+// throttle records a request rejected by the rate limit. a.mu must be held.
+func (a *Admission) throttle(request *Request) {
+	request.UpdateStatus("Throttled")
+	request.leave()
+	if a.StatsManager != nil {
+		a.StatsManager.RecordThrottledRequest(request)
+	}
+	a.Events.Publish(newRequestEvent(EventThrottled, request, 0))
+}
+
+// release lets a held request in and places it.
+func (a *Admission) release(request *Request) {
+	a.mu.Lock()
+	if _, ok := a.held[request]; !ok {
+		a.mu.Unlock()
+		return
+	}
+	delete(a.held, request)
+	a.mu.Unlock()
+
+	a.Place(request)
+}
+
+// Len returns the number of held requests.
+func (a *Admission) Len() int {
+	if a == nil {
+		return 0
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return len(a.held)
+}
+
+// Close stops letting requests in and returns the requests still held.
+// They are never let in, so they are throttled and leave the system.
+func (a *Admission) Close() []*Request {
+	if a == nil {
+		return nil
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.closed = true
+	left := make([]*Request, 0, len(a.held))
+	for request, timer := range a.held {
+		timer.Stop()
+		a.throttle(request)
+		left = append(left, request)
+	}
+	a.held = make(map[*Request]*time.Timer)
+	return left
+}
+
+// Виды ограничения скорости в конфигурации
+const (
+	LimitTokenBucket   = "token_bucket"
+	LimitSlidingWindow = "sliding_window"
+)
+
+// Что происходит с заявкой сверх лимита
+const (
+	AdmissionReject = "reject" // Заявка отклоняется
+	AdmissionDelay  = "delay"  // Заявка ждет, пока лимит ее пропустит
+)
+
+// RateLimitConfig describes a rate limit of a client in the experiment config.
+type RateLimitConfig struct {
+	Kind   string   `json:"kind"`
+	Rate   float64  `json:"rate,omitempty"`   // token_bucket: заявок в секунду
+	Burst  int      `json:"burst,omitempty"`  // token_bucket: по умолчанию 1
+	Limit  int      `json:"limit,omitempty"`  // sliding_window: заявок за окно
+	Window Duration `json:"window,omitempty"` // sliding_window
+}
+
+// Limiter creates a new rate limiter described by the config.
+func (rc RateLimitConfig) Limiter() (RateLimiter, error) {
+	switch rc.Kind {
+	case LimitTokenBucket:
+		if rc.Rate <= 0 {
+			return nil, fmt.Errorf("token bucket: rate must be positive")
+		}
+		if rc.Burst < 0 {
+			return nil, fmt.Errorf("token bucket: burst must not be negative")
+		}
+		burst := rc.Burst
+		if burst == 0 {
+			burst = 1
+		}
+		return &TokenBucket{Rate: rc.Rate, Burst: burst}, nil
+	case LimitSlidingWindow:
+		if rc.Limit <= 0 || rc.Window <= 0 {
+			return nil, fmt.Errorf("sliding window: limit and window must be positive")
+		}
+		return &SlidingWindow{Limit: rc.Limit, Window: time.Duration(rc.Window)}, nil
+	}
+	return nil, fmt.Errorf("unknown rate limit kind %q", rc.Kind)
+}
+
+// AdmissionConfig describes the admission control in the experiment config.
+type AdmissionConfig struct {
+	Mode     string   `json:"mode"`                // reject, delay
+	MaxDelay Duration `json:"max_delay,omitempty"` // delay: сколько заявка может ждать допуска, 0 - сколько нужно
+
+	// Лимит каждого клиента; у каждого клиента своя корзина или окно
+	Limit        *RateLimitConfig           `json:"limit,omitempty"`
+	ClientLimits map[string]RateLimitConfig `json:"client_limits,omitempty"` // По ID клиента
+}
+
+// Admission creates the admission control of the clients described by the config.
+func (ac AdmissionConfig) Admission(clients []*Client) (*Admission, error) {
+	admission := &Admission{Limiters: make(map[string]RateLimiter), held: make(map[*Request]*time.Timer)}
+	switch ac.Mode {
+	case AdmissionReject:
+	case AdmissionDelay:
+		if ac.MaxDelay < 0 {
+			return nil, fmt.Errorf("max_delay must not be negative")
+		}
+		admission.MaxDelay = time.Duration(ac.MaxDelay)
+		if admission.MaxDelay == 0 {
+			admission.MaxDelay = math.MaxInt64
+		}
+	default:
+		return nil, fmt.Errorf("unknown admission mode %q", ac.Mode)
+	}
+
+	known := make(map[string]bool, len(clients))
+	for _, client := range clients {
+		known[client.ID] = true
+		rc, ok := ac.ClientLimits[client.ID]
+		if !ok {
+			if ac.Limit == nil {
+				continue
+			}
+			rc = *ac.Limit
+		}
+		limiter, err := rc.Limiter()
+		if err != nil {
+			return nil, fmt.Errorf("client %s: %w", client.ID, err)
+		}
+		admission.Limiters[client.ID] = limiter
+	}
+	for id := range ac.ClientLimits {
+		if !known[id] {
+			return nil, fmt.Errorf("client_limits: unknown client %s", id)
+		}
+	}
+	return admission, nil
+}
@@ -0,0 +1,168 @@
+package requestsystem
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAdmissionAdmit(t *testing.T) {
+	limit := &RateLimitConfig{Kind: LimitTokenBucket, Rate: 0.001, Burst: 1}
+	tests := []struct {
+		name string
+		cfg  AdmissionConfig
+		want []AdmitDecision
+	}{
+		{"reject over the limit", AdmissionConfig{Mode: AdmissionReject, Limit: limit},
+			[]AdmitDecision{AdmitNow, AdmitThrottled, AdmitThrottled}},
+		{"delay over the limit", AdmissionConfig{Mode: AdmissionDelay, Limit: limit},
+			[]AdmitDecision{AdmitNow, AdmitHeld, AdmitHeld}},
+		{"delay longer than max_delay", AdmissionConfig{Mode: AdmissionDelay, MaxDelay: Duration(time.Second), Limit: limit},
+			[]AdmitDecision{AdmitNow, AdmitThrottled}},
+		{"no limit", AdmissionConfig{Mode: AdmissionReject},
+			[]AdmitDecision{AdmitNow, AdmitNow, AdmitNow}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &Client{ID: "1"}
+			admission, err := tt.cfg.Admission([]*Client{client})
+			if err != nil {
+				t.Fatal(err)
+			}
+			admission.Place = func(request *Request) {}
+			defer admission.Close()
+
+			for i, want := range tt.want {
+				request := client.SubmitRequest("Test")
+				if got := admission.Admit(request); got != want {
+					t.Fatalf("request %d: Admit() = %d, want %d", i, got, want)
+				}
+				if got := isDone(request); got != (want == AdmitThrottled) {
+					t.Fatalf("request %d: left the system = %v, want %v", i, got, want == AdmitThrottled)
+				}
+			}
+		})
+	}
+}
+
+func TestAdmissionCloseThrottlesHeld(t *testing.T) {
+	client := &Client{ID: "1"}
+	admission, err := AdmissionConfig{
+		Mode:  AdmissionDelay,
+		Limit: &RateLimitConfig{Kind: LimitTokenBucket, Rate: 0.001, Burst: 1},
+	}.Admission([]*Client{client})
+	if err != nil {
+		t.Fatal(err)
+	}
+	admission.StatsManager = newTestStatsManager(t, 1)
+	admission.Place = func(request *Request) { t.Errorf("request %d was placed after Close", request.ID) }
+
+	admission.Admit(client.SubmitRequest("Test"))
+	held := client.SubmitRequest("Test")
+	if got := admission.Admit(held); got != AdmitHeld {
+		t.Fatalf("Admit() = %d, want AdmitHeld", got)
+	}
+
+	left := admission.Close()
+	if len(left) != 1 || left[0] != held {
+		t.Fatalf("Close() = %v, want the held request", left)
+	}
+	if !isDone(held) {
+		t.Error("held request has not left the system")
+	}
+	if got := admission.StatsManager.Snapshot().ThrottledRequests; got != 1 {
+		t.Errorf("ThrottledRequests = %d, want 1", got)
+	}
+	if got := admission.Admit(client.SubmitRequest("Test")); got != AdmitThrottled {
+		t.Errorf("Admit() after Close = %d, want AdmitThrottled", got)
+	}
+}
+
+// reservation is a call of RateLimiter.Reserve at offset from the start and its expected result.
+type reservation struct {
+	offset    time.Duration
+	maxDelay  time.Duration
+	wantDelay time.Duration
+	wantOK    bool
+}
+
+// checkReservations makes the reservations in order and compares the results.
+func checkReservations(t *testing.T, limiter RateLimiter, reservations []reservation) {
+	t.Helper()
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i, r := range reservations {
+		delay, ok := limiter.Reserve(start.Add(r.offset), r.maxDelay)
+		if delay != r.wantDelay || ok != r.wantOK {
+			t.Fatalf("reservation %d at %v: Reserve() = %v, %v; want %v, %v", i, r.offset, delay, ok, r.wantDelay, r.wantOK)
+		}
+	}
+}
+
+func TestTokenBucketReserve(t *testing.T) {
+	tests := []struct {
+		name         string
+		rate         float64
+		burst        int
+		reservations []reservation
+	}{
+		{"burst then reject", 2, 2, []reservation{
+			{0, 0, 0, true},
+			{0, 0, 0, true},
+			{0, 0, 500 * time.Millisecond, false},
+		}},
+		{"refill", 2, 1, []reservation{
+			{0, 0, 0, true},
+			{250 * time.Millisecond, 0, 250 * time.Millisecond, false},
+			{500 * time.Millisecond, 0, 0, true},
+			{10 * time.Second, 0, 0, true}, // Корзина не переполняется сверх Burst
+			{10 * time.Second, 0, 500 * time.Millisecond, false},
+		}},
+		{"delayed requests pay back later tokens", 2, 1, []reservation{
+			{0, 0, 0, true},
+			{0, time.Second, 500 * time.Millisecond, true},
+			{0, time.Second, time.Second, true},
+			{0, time.Second, 1500 * time.Millisecond, false},
+			{time.Second, 0, 500 * time.Millisecond, false},
+			{1500 * time.Millisecond, 0, 0, true},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkReservations(t, &TokenBucket{Rate: tt.rate, Burst: tt.burst}, tt.reservations)
+		})
+	}
+}
+
+func TestSlidingWindowReserve(t *testing.T) {
+	tests := []struct {
+		name         string
+		limit        int
+		window       time.Duration
+		reservations []reservation
+	}{
+		{"limit then reject", 2, time.Second, []reservation{
+			{0, 0, 0, true},
+			{100 * time.Millisecond, 0, 0, true},
+			{200 * time.Millisecond, 0, 800 * time.Millisecond, false},
+			{time.Second + time.Millisecond, 0, 0, true}, // Первый допуск вышел из окна
+			{time.Second + 2*time.Millisecond, 0, 98 * time.Millisecond, false},
+		}},
+		{"delayed requests take future places", 2, time.Second, []reservation{
+			{0, 0, 0, true},
+			{100 * time.Millisecond, 0, 0, true},
+			{200 * time.Millisecond, time.Second, 800 * time.Millisecond, true},
+			{300 * time.Millisecond, time.Second, 800 * time.Millisecond, true},
+			{1500 * time.Millisecond, 0, 500 * time.Millisecond, false},
+			{2100 * time.Millisecond, 0, 0, true},
+		}},
+		{"admission order is kept", 1, time.Second, []reservation{
+			{0, 0, 0, true},
+			{0, 2 * time.Second, time.Second, true},
+			{500 * time.Millisecond, 2 * time.Second, 1500 * time.Millisecond, true},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkReservations(t, &SlidingWindow{Limit: tt.limit, Window: tt.window}, tt.reservations)
+		})
+	}
+}
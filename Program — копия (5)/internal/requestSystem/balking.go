@@ -0,0 +1,80 @@
+package requestsystem
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+// QueueState is what a client sees before its request joins the buffer.
+type QueueState struct {
+	QueueLength  int
+	Capacity     int
+	ExpectedWait time.Duration // Оценка ожидания по среднему времени обработки, 0 - пока не известна
+}
+
+// Balking decides whether a client refuses to join the queue it sees.
+type Balking interface {
+	Balk(state QueueState) bool
+}
+
+// BalkingFunc is a custom balking rule.
+type BalkingFunc func(state QueueState) bool
+
+// Balk calls the function.
+func (f BalkingFunc) Balk(state QueueState) bool {
+	return f(state)
+}
+
+// ThresholdBalking refuses to join when the queue is at least QueueLength long
+// or the expected wait is at least ExpectedWait. Zero limits are not checked.
+type ThresholdBalking struct {
+	QueueLength  int
+	ExpectedWait time.Duration
+}
+
+// Balk compares the queue with the thresholds.
+func (b ThresholdBalking) Balk(state QueueState) bool {
+	if b.QueueLength > 0 && state.QueueLength >= b.QueueLength {
+		return true
+	}
+	return b.ExpectedWait > 0 && state.ExpectedWait >= b.ExpectedWait
+}
+
+// LinearBalking refuses to join with a probability equal to the occupancy of the buffer.
+type LinearBalking struct{}
+
+// Balk draws the decision with probability QueueLength/Capacity.
+func (LinearBalking) Balk(state QueueState) bool {
+	if state.Capacity <= 0 {
+		return false
+	}
+	return rand.Float64() < float64(state.QueueLength)/float64(state.Capacity)
+}
+
+// Виды отказа от очереди в конфигурации
+const (
+	BalkingThreshold = "threshold"
+	BalkingLinear    = "linear"
+)
+
+// BalkingConfig describes a balking rule in the experiment config.
+type BalkingConfig struct {
+	Kind         string   `json:"kind"`
+	QueueLength  int      `json:"queue_length,omitempty"`  // threshold
+	ExpectedWait Duration `json:"expected_wait,omitempty"` // threshold
+}
+
+// Balking creates the balking rule described by the config.
+func (bc BalkingConfig) Balking() (Balking, error) {
+	switch bc.Kind {
+	case BalkingThreshold:
+		if bc.QueueLength <= 0 && bc.ExpectedWait <= 0 {
+			return nil, fmt.Errorf("threshold balking: queue_length or expected_wait must be positive")
+		}
+		return ThresholdBalking{QueueLength: bc.QueueLength, ExpectedWait: time.Duration(bc.ExpectedWait)}, nil
+	case BalkingLinear:
+		return LinearBalking{}, nil
+	}
+	return nil, fmt.Errorf("unknown balking kind %q", bc.Kind)
+}
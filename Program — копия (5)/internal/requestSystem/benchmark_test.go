@@ -0,0 +1,122 @@
+package requestsystem
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+)
+
+const benchmarkBufferCap = 1024
+
+// newRequests creates n requests of one client.
+func newRequests(n int) []*Request {
+	client := &Client{ID: "1"}
+	requests := make([]*Request, n)
+	for i := range requests {
+		requests[i] = client.SubmitRequest("Bench")
+	}
+	return requests
+}
+
+// BenchmarkBufferAddTake measures adding a request and taking the oldest one.
+func BenchmarkBufferAddTake(b *testing.B) {
+	buffer := NewBuffer(benchmarkBufferCap)
+	for _, request := range newRequests(benchmarkBufferCap / 2) {
+		buffer.PushRequest(request)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		buffer.PushRequest(buffer.GetNextRequest())
+	}
+}
+
+// BenchmarkBufferPushFull measures adding a request to the full buffer, which displaces the newest one.
+func BenchmarkBufferPushFull(b *testing.B) {
+	buffer := NewBuffer(benchmarkBufferCap)
+	requests := newRequests(benchmarkBufferCap + 1)
+	for _, request := range requests[:benchmarkBufferCap] {
+		buffer.PushRequest(request)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	spare := requests[benchmarkBufferCap]
+	for i := 0; i < b.N; i++ {
+		spare = buffer.PushRequest(spare)
+	}
+}
+
+// BenchmarkBufferRemove measures removing a request from the middle of the full buffer, as priority disciplines do.
+func BenchmarkBufferRemove(b *testing.B) {
+	buffer := NewBuffer(benchmarkBufferCap)
+	requests := newRequests(benchmarkBufferCap)
+	for _, request := range requests {
+		buffer.PushRequest(request)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		request := requests[(i*7919)%benchmarkBufferCap]
+		buffer.RemoveRequest(request)
+		buffer.PushRequest(request)
+	}
+}
+
+// BenchmarkBufferTakeHighestPriority measures the priority discipline on the full buffer with several priorities.
+func BenchmarkBufferTakeHighestPriority(b *testing.B) {
+	buffer := NewBuffer(benchmarkBufferCap)
+	classes := []*RequestClass{{Name: "Low"}, {Name: "Normal", Priority: 1}, {Name: "High", Priority: 2}}
+	client := &Client{ID: "1"}
+	for i := 0; i < benchmarkBufferCap; i++ {
+		buffer.PushRequest(client.SubmitClassRequest(classes[i%len(classes)]))
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		buffer.PushRequest(buffer.TakeHighestPriority(nil))
+	}
+}
+
+// BenchmarkSimulationEvents measures the whole placement and dispatch path of a worker pool with a handler
+// that does nothing, and reports how many request events per second it publishes.
+func BenchmarkSimulationEvents(b *testing.B) {
+	pool, err := NewWorkerPool(WorkerPoolConfig{
+		Workers:   8,
+		BufferCap: benchmarkBufferCap,
+		Handler:   func(ctx context.Context, request *Request) error { return nil },
+		StatsFile: filepath.Join(b.TempDir(), "stats.log"),
+	})
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer pool.Close()
+
+	sub := pool.Events.Subscribe(EventFilter{}, 4096)
+	received := make(chan int64)
+	go func() {
+		var n int64
+		for range sub.C {
+			n++
+		}
+		received <- n
+	}()
+
+	client := &Client{ID: "1"}
+	pool.Start(context.Background())
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		pool.Submit(client, nil)
+	}
+	pool.Stop()
+	b.StopTimer()
+
+	pool.Events.Unsubscribe(sub)
+	events := <-received + sub.Dropped()
+	b.ReportMetric(float64(events)/b.Elapsed().Seconds(), "events/s")
+}
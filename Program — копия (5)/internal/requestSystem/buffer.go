@@ -2,122 +2,449 @@ package requestsystem
 
 import (
 	"fmt"
-	"math"
+	"sort"
 	"sync"
+	"time"
 )
 
-// Buffer represents a circular buffer for requests.
+// noSlot marks the absence of a neighbour in the list of slots.
+const noSlot = -1
+
+// bufferSlot is a place in the buffer. Occupied slots form a doubly linked list
+// from the oldest request to the newest one, free slots form a stack.
+// Besides, every occupied slot is in the list of its priority and in the list of its client.
+type bufferSlot struct {
+	request    *Request
+	prev, next int
+	groups     [2]bufferLink // Соседи в списках индексов byPriority и byClient
+	seq        int64         // Порядок в очереди: чем меньше, тем ближе к голове
+	expiry     *time.Timer   // Таймер ухода заявки из буфера, может быть nil
+}
+
+// bufferLink links a slot with its neighbours in a list of an index.
+type bufferLink struct {
+	prev, next int
+}
+
+// bufferGroup is the list of the buffered requests with the same priority or client, from the oldest to the newest.
+type bufferGroup struct {
+	oldest, newest int
+}
+
+// Индексы заявок буфера
+const (
+	byPriority = iota
+	byClient
+)
+
+// Политики вытеснения из полного буфера
+const (
+	EvictNewest         = "newest"          // Вытесняется последняя заявка
+	EvictLowestPriority = "lowest_priority" // Вытесняется заявка с наименьшим приоритетом, из равных - последняя
+)
+
+// Buffer represents a bounded FIFO buffer for requests.
+// Adding, taking the oldest request and removing any request by its pointer take O(1),
+// so disciplines that pick requests out of order do not pay for shifting the rest.
+// The requests are also indexed by priority and by client: taking the request with the highest
+// priority and evicting the one with the lowest take O(number of priorities), taking a request
+// by its client (TakeByClient) takes O(number of clients). TakeBest with an arbitrary comparison
+// and every take limited by eligible look through the requests.
+// All fields are guarded by mu, so the buffer is used only through its methods.
 type Buffer struct {
-	Requests []*Request
 	Capacity int
-	Head     int // Points to the next position to write
-	Tail     int // Points to the next position to read
-	Full     bool
-	mu       sync.Mutex
+	Eviction string // Политика вытеснения из полного буфера, по умолчанию EvictNewest
+
+	slots      []bufferSlot
+	free       []int // Индексы свободных слотов
+	oldest     int   // Первая заявка в очереди
+	newest     int   // Последняя заявка в очереди
+	count      int
+	priorities map[int]*bufferGroup    // Заявки по приоритету
+	levels     []int                   // Приоритеты заявок буфера по возрастанию
+	clients    map[string]*bufferGroup // Заявки по ID клиента
+	front      int64                   // seq следующей заявки, возвращенной в голову очереди
+	back       int64                   // seq следующей заявки в хвосте очереди
+	mu         sync.Mutex
 }
 
-// AddRequest adds a request to the circular buffer.
+// AddRequest adds a request to the buffer and reports whether no other request was displaced.
 func (b *Buffer) AddRequest(request *Request) bool {
+	return b.PushRequest(request) == nil
+}
+
+// PushRequest adds a request to the buffer and returns the request it displaced, if any.
+// When the buffer is full, the newest request is displaced.
+func (b *Buffer) PushRequest(request *Request) *Request {
+	return b.PushRequestWithPatience(request, 0, nil)
+}
+
+// PushRequestWithPatience adds a request that leaves the buffer by itself after patience,
+// if it is still there, and is then passed to onExpire. Zero patience means no expiry.
+// It returns the request it displaced, if any. With EvictLowestPriority the displaced request
+// may be the request itself, which is then not added.
+func (b *Buffer) PushRequestWithPatience(request *Request, patience time.Duration, onExpire func(request *Request)) *Request {
+	return b.push(request, patience, onExpire, false)
+}
+
+// ReturnRequest puts a request back at the head of the buffer, before the oldest request,
+// e.g. a request whose processing was preempted. Otherwise it works as PushRequestWithPatience.
+func (b *Buffer) ReturnRequest(request *Request, patience time.Duration, onExpire func(request *Request)) *Request {
+	return b.push(request, patience, onExpire, true)
+}
+
+// push adds a request at the tail or, with front, at the head of the buffer.
+func (b *Buffer) push(request *Request, patience time.Duration, onExpire func(request *Request), front bool) *Request {
 	b.mu.Lock()
-	// defer b.mu.Unlock()
+	defer b.mu.Unlock()
 
-	status := true
+	var displaced *Request
+	if b.count == b.Capacity {
+		victim := b.evictionVictim()
+		if b.Eviction == EvictLowestPriority && request.Priority() < b.slots[victim].request.Priority() {
+			// Новая заявка важна меньше всех заявок буфера и вытесняется сама
+			return request
+		}
+		// If buffer is full, overwrite the victim request
+		displaced = b.slots[victim].request
+		b.unlink(victim)
+	}
 
-	if b.Full {
-		// If buffer is full, overwrite the last request (Head - 1)
-		b.Head = (b.Head - 1 + b.Capacity) % b.Capacity
-		status = false
+	slot := b.free[len(b.free)-1]
+	b.free = b.free[:len(b.free)-1]
+	if front {
+		b.slots[slot] = bufferSlot{request: request, prev: noSlot, next: b.oldest, seq: b.front}
+		b.front--
+		if b.oldest != noSlot {
+			b.slots[b.oldest].prev = slot
+		} else {
+			b.newest = slot
+		}
+		b.oldest = slot
+	} else {
+		b.slots[slot] = bufferSlot{request: request, prev: b.newest, next: noSlot, seq: b.back}
+		b.back++
+		if b.newest != noSlot {
+			b.slots[b.newest].next = slot
+		} else {
+			b.oldest = slot
+		}
+		b.newest = slot
 	}
+	b.linkGroup(byPriority, b.priorityGroup(request.Priority()), slot, front)
+	b.linkGroup(byClient, b.clientGroup(request.Client.ID), slot, front)
+	b.count++
+	request.bufferSlot = slot
+	request.bufferedAt = time.Now()
 
-	b.Requests[b.Head] = request
-	b.Head = (b.Head + 1) % b.Capacity
+	if onExpire != nil && patience > 0 {
+		var expiry *time.Timer
+		expiry = time.AfterFunc(patience, func() {
+			if b.expire(slot, expiry) {
+				onExpire(request)
+			}
+		})
+		b.slots[slot].expiry = expiry
+	}
 
-	if b.Head == b.Tail {
-		b.Full = true
+	return displaced
+}
+
+// evictionVictim returns the slot of the request displaced from the full buffer. b.mu must be held.
+// With EvictLowestPriority it is the newest request of the lowest priority.
+func (b *Buffer) evictionVictim() int {
+	if b.Eviction != EvictLowestPriority {
+		return b.newest
+	}
+	return b.priorities[b.levels[0]].newest
+}
+
+// priorityGroup returns the list of the requests with the priority, creating it if needed. b.mu must be held.
+func (b *Buffer) priorityGroup(priority int) *bufferGroup {
+	group, ok := b.priorities[priority]
+	if !ok {
+		group = &bufferGroup{oldest: noSlot, newest: noSlot}
+		b.priorities[priority] = group
+		i := sort.SearchInts(b.levels, priority)
+		b.levels = append(b.levels, 0)
+		copy(b.levels[i+1:], b.levels[i:])
+		b.levels[i] = priority
+	}
+	return group
+}
+
+// clientGroup returns the list of the requests of the client, creating it if needed. b.mu must be held.
+func (b *Buffer) clientGroup(clientID string) *bufferGroup {
+	group, ok := b.clients[clientID]
+	if !ok {
+		group = &bufferGroup{oldest: noSlot, newest: noSlot}
+		b.clients[clientID] = group
 	}
-	b.mu.Unlock()
-	return status
+	return group
 }
 
-// RemoveRequest removes a specific request from the buffer.
-func (b *Buffer) RemoveRequest(request *Request) {
+// linkGroup adds the slot to the tail or, with front, to the head of the list of the index. b.mu must be held.
+func (b *Buffer) linkGroup(index int, group *bufferGroup, slot int, front bool) {
+	if front {
+		b.slots[slot].groups[index] = bufferLink{prev: noSlot, next: group.oldest}
+		if group.oldest != noSlot {
+			b.slots[group.oldest].groups[index].prev = slot
+		} else {
+			group.newest = slot
+		}
+		group.oldest = slot
+		return
+	}
+	b.slots[slot].groups[index] = bufferLink{prev: group.newest, next: noSlot}
+	if group.newest != noSlot {
+		b.slots[group.newest].groups[index].next = slot
+	} else {
+		group.oldest = slot
+	}
+	group.newest = slot
+}
+
+// unlinkGroup removes the slot from the list of the index and reports whether the list became empty. b.mu must be held.
+func (b *Buffer) unlinkGroup(index int, group *bufferGroup, slot int) bool {
+	link := b.slots[slot].groups[index]
+	if link.prev != noSlot {
+		b.slots[link.prev].groups[index].next = link.next
+	} else {
+		group.oldest = link.next
+	}
+	if link.next != noSlot {
+		b.slots[link.next].groups[index].prev = link.prev
+	} else {
+		group.newest = link.prev
+	}
+	return group.oldest == noSlot
+}
+
+// expire removes the request of the slot if the slot is still held by the timer.
+func (b *Buffer) expire(slot int, expiry *time.Timer) bool {
 	b.mu.Lock()
 	defer b.mu.Unlock()
 
-	for i := b.Tail; i != b.Head; i = (i + 1) % b.Capacity {
-		if b.Requests[i] == request {
-			// Shift all subsequent requests to the left
-			for j := i; j != b.Head; j = (j + 1) % b.Capacity {
-				next := (j + 1) % b.Capacity
-				b.Requests[j] = b.Requests[next]
-			}
-			b.Head = (b.Head - 1 + b.Capacity) % b.Capacity
-			break
-		}
+	if b.slots[slot].expiry != expiry {
+		// Заявка уже покинула буфер
+		return false
 	}
+	b.unlink(slot)
+	return true
 }
 
-// GetNextRequest gets the next request from the circular buffer and removes it.
+// RemoveRequest removes a specific request from the buffer and reports whether it was there.
+func (b *Buffer) RemoveRequest(request *Request) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	slot := request.bufferSlot
+	if slot < 0 || slot >= len(b.slots) || b.slots[slot].request != request {
+		return false
+	}
+	b.unlink(slot)
+	return true
+}
+
+// GetNextRequest gets the oldest request from the buffer and removes it.
 func (b *Buffer) GetNextRequest() *Request {
 	b.mu.Lock()
 	defer b.mu.Unlock()
 
-	if !b.Full && b.Head == b.Tail {
+	if b.count == 0 {
 		return nil // Buffer is empty
 	}
+	request := b.slots[b.oldest].request
+	b.unlink(b.oldest)
+	return request
+}
+
+// TakeBest removes and returns the eligible buffered request that no other eligible request is better than,
+// the oldest one among equal requests. better reports whether a is better than b; nil better takes the oldest
+// eligible request. nil eligible accepts any request. eligible and better are called with b.mu held.
+func (b *Buffer) TakeBest(better func(a, b *Request) bool, eligible func(request *Request) bool) *Request {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	best := noSlot
+	for slot := b.oldest; slot != noSlot; slot = b.slots[slot].next {
+		request := b.slots[slot].request
+		if eligible != nil && !eligible(request) {
+			continue
+		}
+		if best == noSlot {
+			best = slot
+			if better == nil {
+				break
+			}
+		} else if better(request, b.slots[best].request) {
+			best = slot
+		}
+	}
+	if best == noSlot {
+		return nil // No eligible request
+	}
+	request := b.slots[best].request
+	b.unlink(best)
+	return request
+}
+
+// TakeHighestPriority removes and returns the eligible buffered request with the highest priority,
+// the oldest one among equal priorities. nil eligible accepts any request and then the request is found
+// in O(number of priorities). eligible is called with b.mu held.
+func (b *Buffer) TakeHighestPriority(eligible func(request *Request) bool) *Request {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for i := len(b.levels) - 1; i >= 0; i-- {
+		if slot := b.firstEligible(byPriority, b.priorities[b.levels[i]], eligible); slot != noSlot {
+			request := b.slots[slot].request
+			b.unlink(slot)
+			return request
+		}
+	}
+	return nil // No eligible request
+}
 
-	request := b.Requests[b.Tail]
-	b.Requests[b.Tail] = nil // Удаляем заявку из буфера
-	b.Tail = (b.Tail + 1) % b.Capacity
-	b.Full = false
+// TakeByClient removes and returns the oldest eligible buffered request of the client that no other client
+// with eligible requests is better than; among equal clients the request that came first in the buffer is taken.
+// better reports whether the client with ID a is better than the client with ID b. nil eligible accepts any request
+// and then the request is found in O(number of clients). eligible and better are called with b.mu held.
+func (b *Buffer) TakeByClient(better func(a, b string) bool, eligible func(request *Request) bool) *Request {
+	b.mu.Lock()
+	defer b.mu.Unlock()
 
+	best, bestID := noSlot, ""
+	for id, group := range b.clients {
+		slot := b.firstEligible(byClient, group, eligible)
+		if slot == noSlot {
+			continue
+		}
+		if best == noSlot || better(id, bestID) || !better(bestID, id) && b.slots[slot].seq < b.slots[best].seq {
+			best, bestID = slot, id
+		}
+	}
+	if best == noSlot {
+		return nil // No eligible request
+	}
+	request := b.slots[best].request
+	b.unlink(best)
 	return request
 }
 
-// IsFull checks if the circular buffer is full.
+// firstEligible returns the oldest slot of the list of the index accepted by eligible, or noSlot. b.mu must be held.
+func (b *Buffer) firstEligible(index int, group *bufferGroup, eligible func(request *Request) bool) int {
+	for slot := group.oldest; slot != noSlot; slot = b.slots[slot].groups[index].next {
+		if eligible == nil || eligible(b.slots[slot].request) {
+			return slot
+		}
+	}
+	return noSlot
+}
+
+// unlink removes the request in the slot from the list and frees the slot. b.mu must be held.
+func (b *Buffer) unlink(slot int) {
+	s := b.slots[slot]
+	if s.expiry != nil {
+		s.expiry.Stop()
+	}
+	if s.prev != noSlot {
+		b.slots[s.prev].next = s.next
+	} else {
+		b.oldest = s.next
+	}
+	if s.next != noSlot {
+		b.slots[s.next].prev = s.prev
+	} else {
+		b.newest = s.prev
+	}
+
+	if priority := s.request.Priority(); b.unlinkGroup(byPriority, b.priorities[priority], slot) {
+		delete(b.priorities, priority)
+		i := sort.SearchInts(b.levels, priority)
+		b.levels = append(b.levels[:i], b.levels[i+1:]...)
+	}
+	if id := s.request.Client.ID; b.unlinkGroup(byClient, b.clients[id], slot) {
+		delete(b.clients, id)
+	}
+
+	s.request.bufferSlot = noSlot
+	b.slots[slot] = bufferSlot{prev: noSlot, next: noSlot}
+	b.free = append(b.free, slot)
+	b.count--
+}
+
+// Requests returns the buffered requests from the oldest to the newest.
+func (b *Buffer) Requests() []*Request {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	requests := make([]*Request, 0, b.count)
+	for slot := b.oldest; slot != noSlot; slot = b.slots[slot].next {
+		requests = append(requests, b.slots[slot].request)
+	}
+	return requests
+}
+
+// IsFull checks if the buffer is full.
 func (b *Buffer) IsFull() bool {
-	return b.Full
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.count == b.Capacity
 }
 
+// IsEmpty checks if the buffer is empty.
 func (b *Buffer) IsEmpty() bool {
-	// Если указатель Head равен указателю Tail и буфер не полон, значит буфер пуст
-	return b.Head == b.Tail && !b.Full
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.count == 0
 }
 
-// PrintBufferContent prints the current content of the buffer.
-func (b *Buffer) PrintBufferContent() {
+// Len returns the number of requests currently stored in the buffer.
+func (b *Buffer) Len() int {
 	b.mu.Lock()
 	defer b.mu.Unlock()
+	return b.count
+}
+
+// PrintBufferContent prints the current content of the buffer.
+func (b *Buffer) PrintBufferContent() {
+	requests := b.Requests()
 
-	fmt.Println("[ Buffer Content: ]", "{ ", math.Abs(float64(b.Head-b.Tail)), "}")
-	if b.Head == b.Tail && !b.Full {
+	fmt.Println("[ Buffer Content: ]", "{ ", len(requests), "}")
+	if len(requests) == 0 {
 		fmt.Println("Buffer is empty")
 		return
 	}
 
 	// Если буфер полон, выводим содержимое
-	if b.Full {
+	if len(requests) == b.Capacity {
 		fmt.Println("Buffer is full")
 	}
 
-	// Выводим содержимое буфера, начиная с Tail и заканчивая Head
-	// Для циклического буфера нужно учитывать, что Head может быть меньше Tail
-	for i := 0; i < b.Capacity; i++ {
-		index := (b.Tail + i) % b.Capacity
-		if b.Requests[index] != nil {
-			fmt.Printf("Request ID: %d, Client ID: %s  || ", b.Requests[index].ID, b.Requests[index].Client.ID)
-		}
+	// Выводим содержимое буфера от самой старой заявки к самой новой
+	for _, request := range requests {
+		fmt.Printf("Request ID: %d, Client ID: %s  || ", request.ID, request.Client.ID)
 	}
 	fmt.Println("")
 }
 
-// NewBuffer creates a new circular buffer with the given capacity.
+// NewBuffer creates a new buffer with the given capacity.
 func NewBuffer(capacity int) *Buffer {
-	return &Buffer{
-		Requests: make([]*Request, capacity),
-		Capacity: capacity,
-		Head:     0,
-		Tail:     0,
-		Full:     false,
+	b := &Buffer{
+		Capacity:   capacity,
+		slots:      make([]bufferSlot, capacity),
+		free:       make([]int, 0, capacity),
+		oldest:     noSlot,
+		newest:     noSlot,
+		priorities: make(map[int]*bufferGroup),
+		clients:    make(map[string]*bufferGroup),
+		front:      -1,
+	}
+	// Слоты выдаются с начала массива
+	for i := capacity - 1; i >= 0; i-- {
+		b.slots[i] = bufferSlot{prev: noSlot, next: noSlot}
+		b.free = append(b.free, i)
 	}
+	return b
 }
@@ -0,0 +1,100 @@
+package requestsystem
+
+import "testing"
+
+// bufferRequest creates a request of the client with a class of the given priority.
+func bufferRequest(clientID string, priority int) *Request {
+	client := &Client{ID: clientID}
+	return client.SubmitClassRequest(&RequestClass{Name: "Test", Priority: priority})
+}
+
+func TestBufferTakeHighestPriority(t *testing.T) {
+	tests := []struct {
+		name       string
+		priorities []int
+		returned   int // Индекс заявки, возвращенной в голову очереди после добавления; -1 - нет
+		want       []int
+	}{
+		{"empty", nil, -1, nil},
+		{"fifo within priority", []int{1, 1, 1}, -1, []int{0, 1, 2}},
+		{"highest first", []int{0, 2, 1, 2, 0}, -1, []int{1, 3, 2, 0, 4}},
+		{"returned request goes first within its priority", []int{1, 1, 2}, 1, []int{2, 1, 0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewBuffer(len(tt.priorities) + 1)
+			requests := make([]*Request, len(tt.priorities))
+			for i, priority := range tt.priorities {
+				requests[i] = bufferRequest("c", priority)
+				if i != tt.returned {
+					b.PushRequest(requests[i])
+				}
+			}
+			if tt.returned >= 0 {
+				b.ReturnRequest(requests[tt.returned], 0, nil)
+			}
+
+			for _, i := range tt.want {
+				if got := b.TakeHighestPriority(nil); got != requests[i] {
+					t.Fatalf("took request %v, want %d", got, requests[i].ID)
+				}
+			}
+			if got := b.TakeHighestPriority(nil); got != nil {
+				t.Fatalf("took request %d from an empty buffer", got.ID)
+			}
+		})
+	}
+}
+
+func TestBufferTakeHighestPriorityEligible(t *testing.T) {
+	b := NewBuffer(3)
+	low, high, skipped := bufferRequest("a", 0), bufferRequest("b", 1), bufferRequest("c", 1)
+	b.PushRequest(skipped)
+	b.PushRequest(high)
+	b.PushRequest(low)
+
+	eligible := func(request *Request) bool { return request != skipped }
+	for _, want := range []*Request{high, low, nil} {
+		if got := b.TakeHighestPriority(eligible); got != want {
+			t.Fatalf("took %v, want %v", got, want)
+		}
+	}
+	if b.Len() != 1 {
+		t.Fatalf("Len() = %d, want 1", b.Len())
+	}
+}
+
+func TestBufferEvictLowestPriority(t *testing.T) {
+	tests := []struct {
+		name       string
+		priorities []int
+		incoming   int
+		want       int // Индекс вытесненной заявки; len(priorities) - сама новая заявка
+	}{
+		{"newest of lowest", []int{0, 1, 0}, 1, 2},
+		{"lowest is oldest", []int{0, 2, 1}, 3, 0},
+		{"incoming is the least important", []int{1, 1, 1}, 0, 3},
+		{"equal to lowest displaces it", []int{2, 1, 2}, 1, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewBuffer(len(tt.priorities))
+			b.Eviction = EvictLowestPriority
+			requests := make([]*Request, 0, len(tt.priorities)+1)
+			for _, priority := range tt.priorities {
+				request := bufferRequest("c", priority)
+				requests = append(requests, request)
+				b.PushRequest(request)
+			}
+			incoming := bufferRequest("c", tt.incoming)
+			requests = append(requests, incoming)
+
+			if got := b.PushRequest(incoming); got != requests[tt.want] {
+				t.Fatalf("displaced %v, want request %d", got, requests[tt.want].ID)
+			}
+			if b.Len() != len(tt.priorities) {
+				t.Fatalf("Len() = %d, want %d", b.Len(), len(tt.priorities))
+			}
+		})
+	}
+}
@@ -0,0 +1,89 @@
+package requestsystem
+
+import (
+	"fmt"
+	"time"
+)
+
+// RequestClass describes a category of requests with its own service times, priority and SLA target.
+type RequestClass struct {
+	Name     string
+	Priority int                  // Чем больше, тем важнее заявка
+	SLA      time.Duration        // Целевое время пребывания заявки в системе, 0 - без цели
+	Skill    string               // Навык, нужный для обслуживания, "" - подходит любой специалист
+	Pool     string               // Пул специалистов, куда поступают заявки, "" - первый пул
+	Service  map[int]Distribution // Время обслуживания по группе специалистов; для остальных групп - формула специалиста
+}
+
+// ServiceTime returns the service time distribution of the class for the group of specialists,
+// or nil if the class does not define one. It is safe to call on a nil class.
+func (c *RequestClass) ServiceTime(group int) Distribution {
+	if c == nil {
+		return nil
+	}
+	return c.Service[group]
+}
+
+// ClassArrival is the flow of requests of one class generated by a client.
+type ClassArrival struct {
+	Class   *RequestClass
+	Arrival Distribution // Интервал между заявками класса
+}
+
+// ClassConfig describes a request class in the experiment config.
+type ClassConfig struct {
+	Name     string   `json:"name"`
+	Priority int      `json:"priority"`
+	SLA      Duration `json:"sla,omitempty"`
+	Skill    string   `json:"skill,omitempty"`
+	Pool     string   `json:"pool,omitempty"`
+
+	// Интервал между заявками класса у каждого клиента. Если не задан, используется интервал клиента
+	Arrival        *DistributionConfig           `json:"arrival,omitempty"`
+	ClientArrivals map[string]DistributionConfig `json:"client_arrivals,omitempty"` // По ID клиента
+
+	// Время обслуживания по номеру группы специалистов (1, 2) или пула в порядке пулов
+	Service map[int]DistributionConfig `json:"service,omitempty"`
+}
+
+// Class creates the request class described by the config.
+func (cc ClassConfig) Class() (*RequestClass, error) {
+	if cc.Name == "" {
+		return nil, fmt.Errorf("name is required")
+	}
+	if cc.SLA < 0 {
+		return nil, fmt.Errorf("sla must not be negative")
+	}
+
+	class := &RequestClass{
+		Name:     cc.Name,
+		Priority: cc.Priority,
+		SLA:      time.Duration(cc.SLA),
+		Skill:    cc.Skill,
+		Pool:     cc.Pool,
+		Service:  make(map[int]Distribution, len(cc.Service)),
+	}
+	for group, dc := range cc.Service {
+		if group < 1 {
+			return nil, fmt.Errorf("unknown specialist group %d", group)
+		}
+		d, err := dc.Distribution()
+		if err != nil {
+			return nil, fmt.Errorf("group %d service: %w", group, err)
+		}
+		class.Service[group] = d
+	}
+	return class, nil
+}
+
+// arrival returns the arrival distribution of the class for the client,
+// falling back to clientArrival when the class does not define one.
+func (cc ClassConfig) arrival(clientID string, clientArrival Distribution) (Distribution, error) {
+	if dc, ok := cc.ClientArrivals[clientID]; ok {
+		return dc.Distribution()
+	}
+	if cc.Arrival != nil {
+		return cc.Arrival.Distribution()
+	}
+	return clientArrival, nil
+}
@@ -9,9 +9,26 @@ import (
 
 // Client represents a client that can submit requests.
 type Client struct {
-	ID string
+	ID       string
+	Arrival  Distribution   // Интервал между заявками клиента
+	Patience Distribution   // Сколько заявка клиента ждет в буфере, прежде чем клиент уйдет; nil - ждет бесконечно
+	Balking  Balking        // Отказ встать в очередь, которую видит клиент; nil - клиент встает всегда
+	Classes  []ClassArrival // Потоки заявок по классам; если пусты, заявки генерируются с интервалом Arrival
+
+	// Замкнутая модель: в системе не больше Outstanding заявок клиента, и после ухода заявки
+	// клиент обдумывает следующую в течение Think. 0 - клиент является бесконечным источником
+	Outstanding int
+	Think       Distribution
+
+	// Когда клиент начинает и прекращает генерировать заявки, от начала генерации; Stop 0 - до ее конца
+	Start time.Duration
+	Stop  time.Duration
 }
 
+// ClientHeader is the HTTP header that carries the ID of the client of a request,
+// shared by the load generator and the admission-control proxy.
+const ClientHeader = "X-Client-ID"
+
 var requestCounter int
 var counterMutex sync.Mutex
 
@@ -22,13 +39,71 @@ func (c *Client) SubmitRequest(requestType string) *Request {
 	counter := requestCounter
 	counterMutex.Unlock()
 
-	fmt.Printf("Client %s submitted a request of type %s with ID %d\n", c.ID, requestType, counter)
 	return &Request{
-		ID:        counter,
-		Client:    c,
-		Status:    "New",
-		CreatedAt: time.Now(), // Устанавливаем время создания заявки
+		ID:         counter,
+		Client:     c,
+		Type:       requestType,
+		Status:     "New",
+		CreatedAt:  time.Now(), // Устанавливаем время создания заявки
+		bufferSlot: noSlot,
+		done:       make(chan struct{}),
+	}
+}
+
+// SubmitClassRequest creates a new request of the class and submits it.
+func (c *Client) SubmitClassRequest(class *RequestClass) *Request {
+	request := c.SubmitRequest(class.Name)
+	request.Class = class
+	return request
+}
+
+// ScheduleConfig describes when a client generates requests in the experiment config.
+type ScheduleConfig struct {
+	Start Duration `json:"start,omitempty"`
+	Stop  Duration `json:"stop,omitempty"` // 0 - до конца генерации
+}
+
+// apply sets the generation window of the client.
+func (sc ScheduleConfig) apply(client *Client) error {
+	if sc.Start < 0 || sc.Stop < 0 {
+		return fmt.Errorf("start and stop must not be negative")
+	}
+	if sc.Stop > 0 && sc.Stop <= sc.Start {
+		return fmt.Errorf("stop must be after start")
+	}
+	client.Start, client.Stop = time.Duration(sc.Start), time.Duration(sc.Stop)
+	return nil
+}
+
+// ClosedLoopConfig describes the closed (finite-source) client model in the experiment config.
+type ClosedLoopConfig struct {
+	Outstanding int                `json:"outstanding"` // Сколько заявок клиента может быть в системе одновременно
+	Think       DistributionConfig `json:"think"`       // Время обдумывания после ухода заявки до следующей
+
+	ClientOutstanding map[string]int                `json:"client_outstanding,omitempty"` // По ID клиента
+	ClientThink       map[string]DistributionConfig `json:"client_think,omitempty"`       // По ID клиента
+}
+
+// apply makes the client a closed-loop one.
+func (cc ClosedLoopConfig) apply(client *Client) error {
+	client.Outstanding = cc.Outstanding
+	if n, ok := cc.ClientOutstanding[client.ID]; ok {
+		client.Outstanding = n
+	}
+	if client.Outstanding <= 0 {
+		return fmt.Errorf("outstanding must be positive")
+	}
+
+	dc := cc.Think
+	if d, ok := cc.ClientThink[client.ID]; ok {
+		dc = d
+	}
+	think, err := dc.Distribution()
+	if err != nil {
+		return fmt.Errorf("think: %w", err)
 	}
+	client.Think = think
+	return nil
 }
 
 // GenerateRequests generates requests with a uniform distribution.
@@ -0,0 +1,319 @@
+package requestsystem
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Duration is a time.Duration that is encoded in JSON as a string like "30s".
+// Plain numbers are accepted as milliseconds.
+type Duration time.Duration
+
+// MarshalJSON encodes the duration as a string.
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// UnmarshalJSON decodes the duration from a string or a number of milliseconds.
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	switch value := v.(type) {
+	case float64:
+		*d = Duration(value * float64(time.Millisecond))
+	case string:
+		parsed, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		*d = Duration(parsed)
+	default:
+		return fmt.Errorf("invalid duration %s", data)
+	}
+	return nil
+}
+
+// Config describes a single experiment.
+type Config struct {
+	Lamb       float64  `json:"lamb"`     // ms между заявками каждого клиента, если не задан arrival
+	LambEx     float64  `json:"lamb_ex"`  // коэфф времени работы первой группы специалистов
+	LambEx2    float64  `json:"lamb_ex2"` // коэфф времени работы второй группы специалистов
+	Duration1  Duration `json:"duration1"`
+	Duration2  Duration `json:"duration2"`
+	PauseGen   Duration `json:"pause_gen"`
+	ClientsNum int      `json:"clients_num"`
+	SpecsNum1  int      `json:"specs_num1"`
+	SpecsNum2  int      `json:"specs_num2"`
+	BufferCap  int      `json:"buffer_cap"`
+	StatsFile  string   `json:"stats_file"`
+
+	// Длительность окна, по которому делится статистика, например 1s. Если не задана, статистика не делится на окна
+	StatsWindow Duration `json:"stats_window,omitempty"`
+
+	// При остановке дообработать заявки из буфера и у специалистов в течение DrainTimeout
+	Drain        bool     `json:"drain"`
+	DrainTimeout Duration `json:"drain_timeout"`
+
+	// Распределение интервалов между заявками клиента. Если не задано, интервал постоянен и равен Lamb
+	Arrival        *DistributionConfig           `json:"arrival,omitempty"`
+	ClientArrivals map[string]DistributionConfig `json:"client_arrivals,omitempty"` // По ID клиента
+
+	// Когда клиенты начинают и прекращают генерировать заявки. Если не задано, клиент работает все время duration1
+	ClientSchedule map[string]ScheduleConfig `json:"client_schedule,omitempty"` // По ID клиента
+
+	// Терпение клиента: сколько его заявка ждет в буфере, прежде чем он уйдет. Если не задано, ждет бесконечно
+	Patience       *DistributionConfig           `json:"patience,omitempty"`
+	ClientPatience map[string]DistributionConfig `json:"client_patience,omitempty"` // По ID клиента
+
+	// Отказ клиента вставать в очередь, которую он видит. Если не задано, клиент встает всегда
+	Balking       *BalkingConfig           `json:"balking,omitempty"`
+	ClientBalking map[string]BalkingConfig `json:"client_balking,omitempty"` // По ID клиента
+
+	// Орбита повторных попыток для отклоненных заявок. Если не задана, отклоненные заявки теряются
+	Retrial *RetrialConfig `json:"retrial,omitempty"`
+
+	// Классы заявок. Если заданы, каждый клиент генерирует заявки каждого класса своим потоком
+	Classes []ClassConfig `json:"classes,omitempty"`
+
+	// Дисциплина обслуживания и вытеснения по приоритетам классов. Если не задана, заявки обслуживаются по порядку
+	Scheduling *SchedulingConfig `json:"scheduling,omitempty"`
+
+	// Навыки специалистов и маршрутизация заявок по навыкам классов. Если не заданы, специалисты взаимозаменяемы
+	Skills *SkillsConfig `json:"skills,omitempty"`
+
+	// Именованные пулы специалистов. Если заданы, заменяют группы specs_num1 и specs_num2
+	Pools []PoolConfig `json:"pools,omitempty"`
+
+	// Разделение буфера по клиентам или классам. Если не задано, все заявки ждут в общем буфере
+	Topology *TopologyConfig `json:"topology,omitempty"`
+
+	// Ограничение скорости поступления заявок каждого клиента. Если не задано, заявки допускаются всегда
+	Admission *AdmissionConfig `json:"admission,omitempty"`
+
+	// Замкнутая модель: ограниченное число заявок клиента в системе и время обдумывания между ними.
+	// Если не задана, клиенты - бесконечные источники
+	Closed *ClosedLoopConfig `json:"closed,omitempty"`
+}
+
+// DefaultConfig returns the configuration of the reference experiment.
+func DefaultConfig() Config {
+	return Config{
+		Lamb:       200.0,
+		LambEx:     1.901,
+		LambEx2:    1.005,
+		Duration1:  Duration(30 * time.Second),
+		Duration2:  Duration(60 * time.Second),
+		PauseGen:   Duration(100 * time.Millisecond),
+		ClientsNum: 20,
+		SpecsNum1:  2,
+		SpecsNum2:  1,
+		BufferCap:  10,
+		StatsFile:  "stats1.log",
+
+		DrainTimeout: Duration(10 * time.Second),
+	}
+}
+
+// Validate checks that the configuration describes a runnable experiment.
+func (c Config) Validate() error {
+	switch {
+	case c.Lamb < 0:
+		return fmt.Errorf("lamb must not be negative")
+	case c.ClientsNum <= 0:
+		return fmt.Errorf("clients_num must be positive")
+	case len(c.Pools) == 0 && (c.SpecsNum1 < 0 || c.SpecsNum2 < 0 || c.SpecsNum1+c.SpecsNum2 == 0):
+		return fmt.Errorf("at least one specialist is required")
+	case c.BufferCap <= 0:
+		return fmt.Errorf("buffer_cap must be positive")
+	case c.Duration1 <= 0 || c.Duration2 <= 0:
+		return fmt.Errorf("duration1 and duration2 must be positive")
+	case c.StatsFile == "":
+		return fmt.Errorf("stats_file is required")
+	case c.StatsWindow < 0:
+		return fmt.Errorf("stats_window must not be negative")
+	}
+	if err := validatePools(c.Pools); err != nil {
+		return err
+	}
+	if c.Retrial != nil {
+		if _, err := NewOrbit(*c.Retrial); err != nil {
+			return fmt.Errorf("retrial: %w", err)
+		}
+	}
+	if c.Scheduling != nil {
+		if _, err := c.Scheduling.Scheduler(); err != nil {
+			return fmt.Errorf("scheduling: %w", err)
+		}
+	}
+	if c.Skills != nil {
+		if _, err := c.Skills.Router(); err != nil {
+			return fmt.Errorf("skills: %w", err)
+		}
+		for id := range c.Skills.Specialists {
+			if id < 1 || id > c.specialistsNum() {
+				return fmt.Errorf("skills: unknown specialist %d", id)
+			}
+		}
+	}
+	for _, cc := range c.Classes {
+		for group := range cc.Service {
+			if group > c.groupsNum() {
+				return fmt.Errorf("class %s: unknown specialist group %d", cc.Name, group)
+			}
+		}
+		if cc.Pool != "" && !c.hasPool(cc.Pool) {
+			return fmt.Errorf("class %s: unknown pool %q", cc.Name, cc.Pool)
+		}
+	}
+	clients, err := c.NewClients()
+	if err != nil {
+		return err
+	}
+	if c.Topology != nil {
+		if _, err := c.Topology.Topology(clients, classesOf(clients), NewBuffer(c.BufferCap)); err != nil {
+			return fmt.Errorf("topology: %w", err)
+		}
+	}
+	if c.Admission != nil {
+		if _, err := c.Admission.Admission(clients); err != nil {
+			return fmt.Errorf("admission: %w", err)
+		}
+	}
+	return nil
+}
+
+// specialistsNum returns the number of specialists of all groups or pools.
+func (c Config) specialistsNum() int {
+	if len(c.Pools) == 0 {
+		return c.SpecsNum1 + c.SpecsNum2
+	}
+	n := 0
+	for _, pc := range c.Pools {
+		n += pc.Specialists
+	}
+	return n
+}
+
+// groupsNum returns the number of groups of specialists: two groups or one group per pool.
+func (c Config) groupsNum() int {
+	if len(c.Pools) == 0 {
+		return 2
+	}
+	return len(c.Pools)
+}
+
+// hasPool reports whether the config defines the pool.
+func (c Config) hasPool(name string) bool {
+	for _, pc := range c.Pools {
+		if pc.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// classesOf returns the request classes shared by the clients.
+func classesOf(clients []*Client) []*RequestClass {
+	if len(clients) == 0 {
+		return nil
+	}
+	classes := make([]*RequestClass, 0, len(clients[0].Classes))
+	for _, ca := range clients[0].Classes {
+		classes = append(classes, ca.Class)
+	}
+	return classes
+}
+
+// NewClients creates the clients described by the config with their arrival distributions.
+// Clients share the request classes, so a class is the same object for all of them.
+func (c Config) NewClients() ([]*Client, error) {
+	var arrival Distribution = Constant{Value: time.Duration(c.Lamb * float64(time.Millisecond))}
+	if c.Arrival != nil {
+		d, err := c.Arrival.Distribution()
+		if err != nil {
+			return nil, fmt.Errorf("arrival: %w", err)
+		}
+		arrival = d
+	}
+
+	var patience Distribution
+	if c.Patience != nil {
+		d, err := c.Patience.Distribution()
+		if err != nil {
+			return nil, fmt.Errorf("patience: %w", err)
+		}
+		patience = d
+	}
+
+	var balking Balking
+	if c.Balking != nil {
+		b, err := c.Balking.Balking()
+		if err != nil {
+			return nil, fmt.Errorf("balking: %w", err)
+		}
+		balking = b
+	}
+
+	classes := make([]*RequestClass, 0, len(c.Classes))
+	names := make(map[string]bool, len(c.Classes))
+	for i, cc := range c.Classes {
+		class, err := cc.Class()
+		if err != nil {
+			return nil, fmt.Errorf("class %d: %w", i+1, err)
+		}
+		if names[class.Name] {
+			return nil, fmt.Errorf("class %q is defined twice", class.Name)
+		}
+		names[class.Name] = true
+		classes = append(classes, class)
+	}
+
+	clients := make([]*Client, 0, c.ClientsNum)
+	for i := 1; i <= c.ClientsNum; i++ {
+		client := &Client{ID: strconv.Itoa(i), Arrival: arrival, Patience: patience, Balking: balking}
+		if dc, ok := c.ClientArrivals[client.ID]; ok {
+			d, err := dc.Distribution()
+			if err != nil {
+				return nil, fmt.Errorf("client %s arrival: %w", client.ID, err)
+			}
+			client.Arrival = d
+		}
+		if dc, ok := c.ClientPatience[client.ID]; ok {
+			d, err := dc.Distribution()
+			if err != nil {
+				return nil, fmt.Errorf("client %s patience: %w", client.ID, err)
+			}
+			client.Patience = d
+		}
+		if bc, ok := c.ClientBalking[client.ID]; ok {
+			b, err := bc.Balking()
+			if err != nil {
+				return nil, fmt.Errorf("client %s balking: %w", client.ID, err)
+			}
+			client.Balking = b
+		}
+		for i, cc := range c.Classes {
+			d, err := cc.arrival(client.ID, client.Arrival)
+			if err != nil {
+				return nil, fmt.Errorf("client %s class %s arrival: %w", client.ID, cc.Name, err)
+			}
+			client.Classes = append(client.Classes, ClassArrival{Class: classes[i], Arrival: d})
+		}
+		if sc, ok := c.ClientSchedule[client.ID]; ok {
+			if err := sc.apply(client); err != nil {
+				return nil, fmt.Errorf("client %s schedule: %w", client.ID, err)
+			}
+		}
+		if c.Closed != nil {
+			if err := c.Closed.apply(client); err != nil {
+				return nil, fmt.Errorf("client %s closed loop: %w", client.ID, err)
+			}
+		}
+		clients = append(clients, client)
+	}
+	return clients, nil
+}
@@ -0,0 +1,58 @@
+package requestsystem
+
+import (
+	"context"
+	"fmt"
+	"io"
+)
+
+// consoleBufferSize is the size of the channel of the console subscriber.
+const consoleBufferSize = 4096
+
+// WriteEvents prints the events of the subscription to w until the subscription is cancelled.
+// Printing happens off the hot path: when w is slower than the system, events are dropped
+// by the EventBus and the number of lost events is printed at the end.
+func WriteEvents(w io.Writer, sub *Subscription) {
+	for e := range sub.C {
+		switch e.Type {
+		case EventArrival:
+			fmt.Fprintf(w, "Client %s submitted a request with ID %d\n", e.ClientID, e.RequestID)
+		case EventBuffered:
+			fmt.Fprintf(w, "Request %d added to buffer\n", e.RequestID)
+		case EventDisplaced:
+			fmt.Fprintf(w, "Buffer is full, discarding request %d\n", e.RequestID)
+		case EventAbandoned:
+			fmt.Fprintf(w, "Client %s abandoned request %d\n", e.ClientID, e.RequestID)
+		case EventBalked:
+			fmt.Fprintf(w, "Client %s balked at the queue with request %d\n", e.ClientID, e.RequestID)
+		case EventThrottled:
+			fmt.Fprintf(w, "Client %s is over its rate limit, request %d throttled\n", e.ClientID, e.RequestID)
+		case EventDelayed:
+			fmt.Fprintf(w, "Client %s is over its rate limit, request %d delayed\n", e.ClientID, e.RequestID)
+		case EventOrbit:
+			fmt.Fprintf(w, "Request %d went to the orbit\n", e.RequestID)
+		case EventRetry:
+			fmt.Fprintf(w, "Client %s retries request %d\n", e.ClientID, e.RequestID)
+		case EventDispatched:
+			fmt.Fprintf(w, "Specialist %d Processing request %d\n", e.SpecialistID, e.RequestID)
+		case EventPreempted:
+			fmt.Fprintf(w, "Request %d preempted at spec %d\n", e.RequestID, e.SpecialistID)
+		case EventCompleted:
+			switch e.Error {
+			case "":
+				fmt.Fprintf(w, "Request %d completed by spec %d\n", e.RequestID, e.SpecialistID)
+			case context.Canceled.Error():
+				fmt.Fprintf(w, "Request %d interrupted at spec %d\n", e.RequestID, e.SpecialistID)
+			default:
+				fmt.Fprintf(w, "Request %d failed by spec %d: %s\n", e.RequestID, e.SpecialistID, e.Error)
+			}
+		case EventStats:
+			fmt.Fprintf(w, "[ Stats: ] requests %d, rejected %d, abandoned %d, balked %d, throttled %d, completed %d, buffer %d\n",
+				e.Stats.TotalRequests, e.Stats.RejectedRequests, e.Stats.AbandonedRequests, e.Stats.BalkedRequests, e.Stats.ThrottledRequests,
+				e.Stats.CompletedRequests, e.Stats.BufferOccupancy)
+		}
+	}
+	if dropped := sub.Dropped(); dropped > 0 {
+		fmt.Fprintf(w, "%d events were not printed\n", dropped)
+	}
+}
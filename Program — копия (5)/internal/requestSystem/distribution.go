@@ -0,0 +1,90 @@
+package requestsystem
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+// Distribution produces random time intervals, e.g. the time between two requests of a client.
+type Distribution interface {
+	Sample() time.Duration
+}
+
+// Constant always returns the same interval.
+type Constant struct {
+	Value time.Duration
+}
+
+// Sample returns the constant value.
+func (d Constant) Sample() time.Duration {
+	return d.Value
+}
+
+// Exponential returns exponentially distributed intervals with the given mean (Poisson flow).
+type Exponential struct {
+	Mean time.Duration
+}
+
+// Sample returns an exponentially distributed interval.
+func (d Exponential) Sample() time.Duration {
+	return time.Duration(rand.ExpFloat64() * float64(d.Mean))
+}
+
+// Uniform returns intervals uniformly distributed between Min and Max.
+type Uniform struct {
+	Min time.Duration
+	Max time.Duration
+}
+
+// Sample returns a uniformly distributed interval.
+func (d Uniform) Sample() time.Duration {
+	return d.Min + time.Duration(rand.Float64()*float64(d.Max-d.Min))
+}
+
+// Виды распределений в конфигурации
+const (
+	DistributionConstant    = "constant"
+	DistributionExponential = "exponential"
+	DistributionUniform     = "uniform"
+	DistributionProfile     = "profile" // Пуассоновский поток с меняющейся по профилю интенсивностью
+)
+
+// DistributionConfig describes a distribution in the experiment config.
+type DistributionConfig struct {
+	Kind string   `json:"kind"`
+	Mean Duration `json:"mean,omitempty"` // constant, exponential
+	Min  Duration `json:"min,omitempty"`  // uniform
+	Max  Duration `json:"max,omitempty"`  // uniform
+
+	// profile: CSV-файл со строками "смещение,интенсивность", например почасовое число звонков
+	Profile       string   `json:"profile,omitempty"`
+	Interpolation string   `json:"interpolation,omitempty"` // profile: step, linear; по умолчанию step
+	Unit          Duration `json:"unit,omitempty"`          // profile: единица смещений-чисел и интенсивности, по умолчанию 1s
+	Period        Duration `json:"period,omitempty"`        // profile: период повторения, например 24h; 0 - без повторения
+	TimeScale     float64  `json:"time_scale,omitempty"`    // profile: секунд модельного времени за секунду работы, по умолчанию 1
+}
+
+// Distribution creates the distribution described by the config.
+func (dc DistributionConfig) Distribution() (Distribution, error) {
+	switch dc.Kind {
+	case DistributionConstant:
+		if dc.Mean < 0 {
+			return nil, fmt.Errorf("constant distribution: mean must not be negative")
+		}
+		return Constant{Value: time.Duration(dc.Mean)}, nil
+	case DistributionExponential:
+		if dc.Mean <= 0 {
+			return nil, fmt.Errorf("exponential distribution: mean must be positive")
+		}
+		return Exponential{Mean: time.Duration(dc.Mean)}, nil
+	case DistributionUniform:
+		if dc.Min < 0 || dc.Max < dc.Min {
+			return nil, fmt.Errorf("uniform distribution: need 0 <= min <= max")
+		}
+		return Uniform{Min: time.Duration(dc.Min), Max: time.Duration(dc.Max)}, nil
+	case DistributionProfile:
+		return dc.profileArrival()
+	}
+	return nil, fmt.Errorf("unknown distribution kind %q", dc.Kind)
+}
@@ -0,0 +1,135 @@
+package requestsystem
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Типы событий системы
+const (
+	EventArrival    = "arrival"    // Клиент создал заявку
+	EventBuffered   = "buffered"   // Заявка помещена в буфер
+	EventDisplaced  = "displaced"  // Заявка вытеснена из буфера новой заявкой
+	EventAbandoned  = "abandoned"  // Клиент не дождался обработки и ушел из буфера
+	EventBalked     = "balked"     // Клиент увидел очередь и отказался в нее вставать
+	EventThrottled  = "throttled"  // Заявка отклонена лимитом клиента до попадания в систему
+	EventDelayed    = "delayed"    // Заявка ждет, пока лимит клиента ее пропустит
+	EventOrbit      = "orbit"      // Отклоненная заявка ушла в орбиту повторных попыток
+	EventRetry      = "retry"      // Заявка вернулась из орбиты
+	EventDispatched = "dispatched" // Заявка отправлена специалисту
+	EventPreempted  = "preempted"  // Обработка заявки прервана заявкой с большим приоритетом
+	EventCompleted  = "completed"  // Специалист завершил обработку заявки
+	EventStats      = "stats"      // Периодический снимок статистики
+)
+
+// Event describes something that happened to a request, or a statistics snapshot.
+type Event struct {
+	Type         string         `json:"type"`
+	Time         time.Time      `json:"time"`
+	RequestID    int            `json:"request_id,omitempty"`
+	ClientID     string         `json:"client_id,omitempty"`
+	Class        string         `json:"class,omitempty"`
+	SpecialistID int            `json:"specialist_id,omitempty"`
+	Error        string         `json:"error,omitempty"`
+	Stats        *StatsSnapshot `json:"stats,omitempty"`
+}
+
+// newRequestEvent creates an event about the request.
+func newRequestEvent(eventType string, request *Request, specialistID int) Event {
+	return Event{
+		Type:         eventType,
+		Time:         time.Now(),
+		RequestID:    request.ID,
+		ClientID:     request.Client.ID,
+		Class:        request.ClassName(),
+		SpecialistID: specialistID,
+	}
+}
+
+// EventFilter selects the events a subscriber is interested in. Empty fields match any event.
+// Statistics snapshots are delivered to every subscriber.
+type EventFilter struct {
+	ClientID     string
+	SpecialistID int
+}
+
+// Match reports whether the event passes the filter.
+func (f EventFilter) Match(e Event) bool {
+	if e.Type == EventStats {
+		return true
+	}
+	if f.ClientID != "" && e.ClientID != f.ClientID {
+		return false
+	}
+	if f.SpecialistID != 0 && e.SpecialistID != f.SpecialistID {
+		return false
+	}
+	return true
+}
+
+// Subscription receives the events published on an EventBus.
+type Subscription struct {
+	C       <-chan Event
+	ch      chan Event
+	filter  EventFilter
+	dropped atomic.Int64
+}
+
+// Dropped returns the number of events lost because the subscriber did not keep up.
+func (s *Subscription) Dropped() int64 {
+	return s.dropped.Load()
+}
+
+// EventBus delivers events to subscribers without ever blocking the publisher.
+// Events that do not fit into the subscriber's channel are dropped and counted.
+type EventBus struct {
+	subscribers map[*Subscription]struct{}
+	mu          sync.Mutex
+}
+
+// NewEventBus creates an event bus without subscribers.
+func NewEventBus() *EventBus {
+	return &EventBus{subscribers: make(map[*Subscription]struct{})}
+}
+
+// Subscribe registers a subscriber with a channel of the given size.
+func (eb *EventBus) Subscribe(filter EventFilter, size int) *Subscription {
+	ch := make(chan Event, size)
+	sub := &Subscription{C: ch, ch: ch, filter: filter}
+
+	eb.mu.Lock()
+	eb.subscribers[sub] = struct{}{}
+	eb.mu.Unlock()
+	return sub
+}
+
+// Unsubscribe removes the subscriber and closes its channel.
+func (eb *EventBus) Unsubscribe(sub *Subscription) {
+	eb.mu.Lock()
+	defer eb.mu.Unlock()
+	if _, ok := eb.subscribers[sub]; ok {
+		delete(eb.subscribers, sub)
+		close(sub.ch)
+	}
+}
+
+// Publish sends the event to every matching subscriber. It is safe to call on a nil bus.
+func (eb *EventBus) Publish(e Event) {
+	if eb == nil {
+		return
+	}
+
+	eb.mu.Lock()
+	defer eb.mu.Unlock()
+	for sub := range eb.subscribers {
+		if !sub.filter.Match(e) {
+			continue
+		}
+		select {
+		case sub.ch <- e:
+		default:
+			sub.dropped.Add(1)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package requestsystem
+
+import (
+	"fmt"
+	"html"
+	"os"
+	"strings"
+	"time"
+)
+
+// GenerateHTMLReport writes a self-contained HTML report with inline SVG charts to filename.
+// The report uses the samples collected by LogStatistics, so it has to be called after the run.
+func (rm *ReportManager) GenerateHTMLReport(filename string) error {
+	samples, waitTimes := rm.StatsManager.history()
+
+	var b strings.Builder
+	b.WriteString("<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n<title>Simulation report</title>\n")
+	b.WriteString("<style>body{font-family:sans-serif;margin:20px;color:#222}table{border-collapse:collapse}td,th{border:1px solid #ccc;padding:4px 8px;text-align:right}svg{display:block;margin:16px 0}</style>\n")
+	b.WriteString("</head>\n<body>\n<h1>Simulation report</h1>\n")
+
+	rm.writeHTMLSummary(&b, samples)
+	rm.writeHTMLClients(&b)
+
+	if len(samples) == 0 {
+		b.WriteString("<p>No statistics samples were recorded.</p>\n")
+	} else {
+		start := samples[0].Timestamp
+		x := make([]float64, len(samples))
+		rejection := make([]float64, len(samples))
+		bufferTime := make([]float64, len(samples))
+		processingTime := make([]float64, len(samples))
+		occupancy := make([]float64, len(samples))
+		orbit := make([]float64, len(samples))
+		for i, s := range samples {
+			x[i] = s.Timestamp.Sub(start).Seconds()
+			rejection[i] = s.ProbabilityOfRejection
+			bufferTime[i] = s.AverageBufferTime
+			processingTime[i] = s.AverageProcessingTime
+			occupancy[i] = float64(s.BufferOccupancy)
+			orbit[i] = float64(s.OrbitSize)
+		}
+
+		b.WriteString(svgLineChart("Probability of rejection", "time, s", "probability",
+			[]svgSeries{{Name: "rejection", X: x, Y: rejection}}))
+		b.WriteString(svgLineChart("Average buffer time", "time, s", "ms",
+			[]svgSeries{{Name: "buffer", X: x, Y: bufferTime}}))
+		b.WriteString(svgLineChart("Average processing time", "time, s", "ms",
+			[]svgSeries{{Name: "processing", X: x, Y: processingTime}}))
+
+		var ratios []svgSeries
+		for i := range samples[len(samples)-1].SpecialistWorkTimeRatio {
+			s := svgSeries{Name: fmt.Sprintf("Specialist %d", i+1)}
+			for j, sample := range samples {
+				if i < len(sample.SpecialistWorkTimeRatio) {
+					s.X = append(s.X, x[j])
+					s.Y = append(s.Y, sample.SpecialistWorkTimeRatio[i])
+				}
+			}
+			ratios = append(ratios, s)
+		}
+		b.WriteString(svgLineChart("Specialist work-time ratio", "time, s", "ratio", ratios))
+
+		b.WriteString(svgLineChart("Buffer occupancy", "time, s", "requests",
+			[]svgSeries{{Name: "occupancy", X: x, Y: occupancy}, {Name: "orbit", X: x, Y: orbit}}))
+	}
+
+	rm.writeHTMLWindows(&b)
+
+	waits := make([]float64, len(waitTimes))
+	for i, w := range waitTimes {
+		waits[i] = float64(w) / float64(time.Millisecond)
+	}
+	b.WriteString(svgHistogram("Waiting time in buffer", "ms", waits, 20))
+
+	b.WriteString("</body>\n</html>\n")
+
+	return os.WriteFile(filename, []byte(b.String()), 0o644)
+}
+
+// writeHTMLSummary writes the table with the totals of the last sample.
+func (rm *ReportManager) writeHTMLSummary(b *strings.Builder, samples []StatsSample) {
+	b.WriteString("<table>\n<tr><th>TotalRequests</th><th>RejectedRequests</th><th>ProbabilityOfRejection</th><th>AverageBufferTime, ms</th><th>AverageProcessingTime, ms</th></tr>\n")
+	if len(samples) > 0 {
+		last := samples[len(samples)-1]
+		fmt.Fprintf(b, "<tr><td>%d</td><td>%d</td><td>%.4f</td><td>%.3f</td><td>%.3f</td></tr>\n",
+			last.TotalRequests, last.RejectedRequests, last.ProbabilityOfRejection, last.AverageBufferTime, last.AverageProcessingTime)
+	}
+	b.WriteString("</table>\n")
+	fmt.Fprintf(b, "<p>Generated %s</p>\n", html.EscapeString(time.Now().Format(time.RFC3339)))
+}
+
+// writeHTMLClients writes the table of the requests of every client that left without processing.
+func (rm *ReportManager) writeHTMLClients(b *strings.Builder) {
+	snapshot := rm.StatsManager.Snapshot()
+	if len(snapshot.ClientStats) == 0 {
+		return
+	}
+	b.WriteString("<h2>Clients</h2>\n<table>\n<tr><th>ID</th><th>Requests</th><th>Completed</th><th>Rejected</th><th>Abandoned</th><th>Abandonment</th><th>Balked</th><th>Balking</th><th>AverageWaitTime, ms</th></tr>\n")
+	for _, id := range sortedClientIDs(snapshot) {
+		cs := snapshot.ClientStats[id]
+		fmt.Fprintf(b, "<tr><td>%s</td><td>%d</td><td>%d</td><td>%d</td><td>%d</td><td>%.4f</td><td>%d</td><td>%.4f</td><td>%.3f</td></tr>\n",
+			html.EscapeString(id), cs.Requests, cs.Completed, cs.Rejected, cs.Abandoned, cs.share(cs.Abandoned), cs.Balked, cs.share(cs.Balked), cs.AverageWaitTime())
+	}
+	b.WriteString("</table>\n")
+}
+
+// writeHTMLWindows writes the charts of the time windows, if the statistics are split into them.
+func (rm *ReportManager) writeHTMLWindows(b *strings.Builder) {
+	windows := rm.StatsManager.Snapshot().Windows
+	if len(windows) == 0 {
+		return
+	}
+	x := make([]float64, len(windows))
+	rate := make([]float64, len(windows))
+	loss := make([]float64, len(windows))
+	wait := make([]float64, len(windows))
+	for i, ws := range windows {
+		x[i] = ws.Start.Seconds()
+		rate[i] = ws.ArrivalRate()
+		loss[i] = ws.ProbabilityOfLoss()
+		wait[i] = ws.AverageWaitTime()
+	}
+	b.WriteString(svgLineChart("Arrival rate by window", "window start, s", "1/s",
+		[]svgSeries{{Name: "arrivals", X: x, Y: rate}}))
+	b.WriteString(svgLineChart("Probability of loss by window", "window start, s", "probability",
+		[]svgSeries{{Name: "loss", X: x, Y: loss}}))
+	b.WriteString(svgLineChart("Average buffer time by window", "window start, s", "ms",
+		[]svgSeries{{Name: "buffer", X: x, Y: wait}}))
+}
@@ -0,0 +1,302 @@
+package requestsystem
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Labels are the label pairs of a metric sample.
+type Labels map[string]string
+
+// with returns a copy of the labels with an extra pair.
+func (l Labels) with(name, value string) Labels {
+	labels := make(Labels, len(l)+1)
+	for k, v := range l {
+		labels[k] = v
+	}
+	labels[name] = value
+	return labels
+}
+
+// String formats the labels as {a="1",b="2"} with sorted names.
+func (l Labels) String() string {
+	if len(l) == 0 {
+		return ""
+	}
+	names := make([]string, 0, len(l))
+	for name := range l {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		value := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(l[name])
+		pairs[i] = fmt.Sprintf(`%s="%s"`, name, value)
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+type metricSample struct {
+	labels Labels
+	value  float64
+}
+
+type metricFamily struct {
+	name    string
+	help    string
+	kind    string
+	samples []metricSample
+}
+
+// MetricsWriter collects metric samples and writes them in the Prometheus text exposition format.
+// Samples of the same metric from several simulations are grouped under one HELP/TYPE header.
+type MetricsWriter struct {
+	families []*metricFamily
+	index    map[string]*metricFamily
+}
+
+// NewMetricsWriter creates an empty MetricsWriter.
+func NewMetricsWriter() *MetricsWriter {
+	return &MetricsWriter{index: make(map[string]*metricFamily)}
+}
+
+// Counter adds a sample of a counter metric.
+func (mw *MetricsWriter) Counter(name, help string, labels Labels, value float64) {
+	mw.add(name, help, "counter", labels, value)
+}
+
+// Gauge adds a sample of a gauge metric.
+func (mw *MetricsWriter) Gauge(name, help string, labels Labels, value float64) {
+	mw.add(name, help, "gauge", labels, value)
+}
+
+func (mw *MetricsWriter) add(name, help, kind string, labels Labels, value float64) {
+	family, ok := mw.index[name]
+	if !ok {
+		family = &metricFamily{name: name, help: help, kind: kind}
+		mw.index[name] = family
+		mw.families = append(mw.families, family)
+	}
+	family.samples = append(family.samples, metricSample{labels: labels, value: value})
+}
+
+// WriteTo writes all collected metrics to w.
+func (mw *MetricsWriter) WriteTo(w io.Writer) (int64, error) {
+	var b strings.Builder
+	for _, family := range mw.families {
+		fmt.Fprintf(&b, "# HELP %s %s\n", family.name, family.help)
+		fmt.Fprintf(&b, "# TYPE %s %s\n", family.name, family.kind)
+		for _, sample := range family.samples {
+			fmt.Fprintf(&b, "%s%s %s\n", family.name, sample.labels, formatMetricValue(sample.value))
+		}
+	}
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
+}
+
+func formatMetricValue(v float64) string {
+	switch {
+	case math.IsNaN(v):
+		return "NaN"
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// CollectMetrics adds the statistics and the live state of the simulation to mw.
+func (sim *Simulation) CollectMetrics(mw *MetricsWriter, labels Labels) {
+	collectMetrics(mw, labels, sim.StatsManager, sim.RetrievalManager)
+}
+
+// CollectMetrics adds the statistics and the live state of the pool to mw.
+func (wp *WorkerPool) CollectMetrics(mw *MetricsWriter, labels Labels) {
+	collectMetrics(mw, labels, wp.StatsManager, wp.RetrievalManager)
+}
+
+func collectMetrics(mw *MetricsWriter, labels Labels, statsManager *StatsManager, rm *RetrievalManager) {
+	snapshot := statsManager.Snapshot()
+	specialists := rm.Specialists
+
+	mw.Counter("smo_requests_total", "Total number of generated requests.", labels, float64(snapshot.TotalRequests))
+	mw.Counter("smo_rejected_requests_total", "Number of requests rejected because the buffer was full.", labels, float64(snapshot.RejectedRequests))
+	mw.Counter("smo_completed_requests_total", "Number of requests whose processing finished.", labels, float64(snapshot.CompletedRequests))
+	mw.Counter("smo_failed_requests_total", "Number of requests whose handler returned an error.", labels, float64(snapshot.FailedRequests))
+	mw.Counter("smo_timed_out_requests_total", "Number of requests whose handler exceeded the timeout.", labels, float64(snapshot.TimedOutRequests))
+	mw.Counter("smo_interrupted_requests_total", "Number of requests interrupted by the shutdown of the system.", labels, float64(snapshot.InterruptedRequests))
+	mw.Counter("smo_abandoned_requests_total", "Number of requests whose clients left the buffer before processing.", labels, float64(snapshot.AbandonedRequests))
+	mw.Counter("smo_balked_requests_total", "Number of requests whose clients refused to join the queue.", labels, float64(snapshot.BalkedRequests))
+	mw.Counter("smo_throttled_requests_total", "Number of requests rejected by the rate limits of the clients before entering the system.", labels, float64(snapshot.ThrottledRequests))
+	mw.Counter("smo_delayed_requests_total", "Number of requests that waited for the rate limits of the clients to let them in.", labels, float64(snapshot.DelayedRequests))
+	mw.Gauge("smo_throttling_probability", "Share of requests rejected by the rate limits.", labels, snapshot.ProbabilityOfThrottle)
+	mw.Counter("smo_preemptions_total", "Number of times a request in service was preempted by a request with a higher priority.", labels, float64(snapshot.Preemptions))
+	mw.Counter("smo_first_attempt_rejections_total", "Number of requests rejected at the first attempt.", labels, float64(snapshot.FirstAttemptRejections))
+	mw.Counter("smo_retry_attempts_total", "Number of attempts made by requests coming back from the orbit.", labels, float64(snapshot.RetryAttempts))
+	mw.Gauge("smo_orbit_size", "Number of rejected requests waiting to retry.", labels, float64(snapshot.OrbitSize))
+	mw.Gauge("smo_loss_probability", "Share of requests that left the system without processing.", labels, snapshot.ProbabilityOfLoss)
+	mw.Gauge("smo_rejection_probability", "Share of rejected requests.", labels, snapshot.ProbabilityOfRejection)
+	mw.Gauge("smo_abandonment_probability", "Share of abandoned requests.", labels, snapshot.ProbabilityOfAbandon)
+	mw.Gauge("smo_balking_probability", "Share of balked requests.", labels, snapshot.ProbabilityOfBalking)
+	mw.Counter("smo_buffer_time_seconds_total", "Total time requests spent in the buffer.", labels, snapshot.TotalBufferTime.Seconds())
+	mw.Counter("smo_processing_time_seconds_total", "Total time requests spent being processed.", labels, snapshot.TotalProcessingTime.Seconds())
+	mw.Counter("smo_system_time_seconds_total", "Total running time of the system.", labels, snapshot.TotalSystemTime.Seconds())
+
+	for _, id := range sortedKeys(snapshot.SpecialistUsage) {
+		mw.Counter("smo_specialist_requests_total", "Number of requests processed by the specialist.",
+			labels.with("specialist", strconv.Itoa(id)), float64(snapshot.SpecialistUsage[id]))
+	}
+	for _, id := range sortedKeys(snapshot.SpecialistWorkTime) {
+		mw.Counter("smo_specialist_work_time_seconds_total", "Total work time of the specialist.",
+			labels.with("specialist", strconv.Itoa(id)), snapshot.SpecialistWorkTime[id].Seconds())
+	}
+
+	capacity := 0
+	for _, buffer := range rm.buffers() {
+		capacity += buffer.Capacity
+	}
+	mw.Gauge("smo_buffer_requests", "Number of requests currently in the buffers.", labels, float64(rm.BufferedRequests()))
+	mw.Gauge("smo_buffer_capacity", "Total capacity of the buffers.", labels, float64(capacity))
+	mw.Gauge("smo_busy_specialists", "Number of specialists currently processing a request.", labels, float64(countBusy(specialists)))
+	mw.Gauge("smo_specialists", "Number of specialists.", labels, float64(len(specialists)))
+
+	clientIDs := make([]string, 0, len(snapshot.ClientStats))
+	for id := range snapshot.ClientStats {
+		clientIDs = append(clientIDs, id)
+	}
+	sort.Strings(clientIDs)
+	for _, id := range clientIDs {
+		cs := snapshot.ClientStats[id]
+		clientLabels := labels.with("client", id)
+		mw.Counter("smo_client_requests_total", "Number of requests generated by the client.", clientLabels, float64(cs.Requests))
+		mw.Counter("smo_client_rejected_requests_total", "Number of rejected requests of the client.", clientLabels, float64(cs.Rejected))
+		mw.Counter("smo_client_completed_requests_total", "Number of processed requests of the client.", clientLabels, float64(cs.Completed))
+		mw.Counter("smo_client_failed_requests_total", "Number of failed requests of the client.", clientLabels, float64(cs.Failed))
+		mw.Counter("smo_client_abandoned_requests_total", "Number of abandoned requests of the client.", clientLabels, float64(cs.Abandoned))
+		mw.Counter("smo_client_balked_requests_total", "Number of balked requests of the client.", clientLabels, float64(cs.Balked))
+		mw.Counter("smo_client_throttled_requests_total", "Number of requests of the client rejected by its rate limit.", clientLabels, float64(cs.Throttled))
+		mw.Counter("smo_client_delayed_requests_total", "Number of requests of the client delayed by its rate limit.", clientLabels, float64(cs.Delayed))
+		mw.Counter("smo_client_admission_delay_seconds_total", "Total time the requests of the client waited for its rate limit.", clientLabels, cs.AdmissionDelay.Seconds())
+		mw.Counter("smo_client_response_time_seconds_total", "Total time from creation to the end of processing of the processed requests of the client.", clientLabels, cs.ResponseTime.Seconds())
+		mw.Counter("smo_client_wait_time_seconds_total", "Total time the requests of the client waited in the buffer.", clientLabels, cs.WaitTime.Seconds())
+	}
+	throughputIndex, waitIndex := snapshot.Fairness(schedulerWeights(rm.Scheduler))
+	mw.Gauge("smo_fairness_throughput_index", "Jain's fairness index of the weighted throughput of the clients.", labels, throughputIndex)
+	mw.Gauge("smo_fairness_wait_index", "Jain's fairness index of the average wait times of the clients.", labels, waitIndex)
+
+	classNames := make([]string, 0, len(snapshot.ClassStats))
+	for name := range snapshot.ClassStats {
+		classNames = append(classNames, name)
+	}
+	sort.Strings(classNames)
+	for _, name := range classNames {
+		cs := snapshot.ClassStats[name]
+		classLabels := labels.with("class", name)
+		mw.Counter("smo_class_requests_total", "Number of generated requests of the class.", classLabels, float64(cs.Requests))
+		mw.Counter("smo_class_rejected_requests_total", "Number of rejected requests of the class.", classLabels, float64(cs.Rejected))
+		mw.Counter("smo_class_completed_requests_total", "Number of processed requests of the class.", classLabels, float64(cs.Completed))
+		mw.Counter("smo_class_failed_requests_total", "Number of failed requests of the class.", classLabels, float64(cs.Failed))
+		mw.Counter("smo_class_timed_out_requests_total", "Number of requests of the class whose handler exceeded the timeout.", classLabels, float64(cs.TimedOut))
+		mw.Counter("smo_class_interrupted_requests_total", "Number of requests of the class interrupted by the shutdown.", classLabels, float64(cs.Interrupted))
+		mw.Counter("smo_class_abandoned_requests_total", "Number of abandoned requests of the class.", classLabels, float64(cs.Abandoned))
+		mw.Counter("smo_class_balked_requests_total", "Number of balked requests of the class.", classLabels, float64(cs.Balked))
+		mw.Counter("smo_class_preemptions_total", "Number of times a request of the class was preempted.", classLabels, float64(cs.Preempted))
+		mw.Counter("smo_class_buffer_time_seconds_total", "Total time requests of the class spent in the buffer.", classLabels, cs.BufferTime.Seconds())
+		mw.Counter("smo_class_processing_time_seconds_total", "Total time requests of the class spent being processed.", classLabels, cs.ProcessingTime.Seconds())
+		mw.Counter("smo_class_response_time_seconds_total", "Total time from creation to the end of processing of the class.", classLabels, cs.ResponseTime.Seconds())
+		if cs.SLA > 0 {
+			mw.Gauge("smo_class_sla_seconds", "SLA target of the class.", classLabels, cs.SLA.Seconds())
+			mw.Counter("smo_class_within_sla_total", "Number of requests of the class processed successfully within the SLA.", classLabels, float64(cs.WithinSLA))
+		}
+	}
+
+	if n := len(snapshot.Windows); n > 0 {
+		// Текущее окно показывает нагрузку сейчас, а не в среднем с начала работы
+		ws := snapshot.Windows[n-1]
+		mw.Gauge("smo_window_arrival_rate", "Arrival rate in the current statistics window, 1/s.", labels, ws.ArrivalRate())
+		mw.Gauge("smo_window_loss_probability", "Share of requests lost in the current statistics window.", labels, ws.ProbabilityOfLoss())
+		mw.Gauge("smo_window_wait_time_seconds", "Average buffer time of the requests taken in the current statistics window.", labels, ws.AverageWaitTime()/1e3)
+		mw.Gauge("smo_window_utilization", "Share of the current statistics window the specialists spent working.", labels, ws.Utilization(len(specialists)))
+	}
+
+	collectSkillMetrics(mw, labels, snapshot, specialists)
+	collectPoolMetrics(mw, labels, snapshot, rm.Pools)
+	if rm.Topology != nil {
+		collectQueueMetrics(mw, labels, snapshot, rm.Topology)
+	}
+}
+
+// collectQueueMetrics adds the live state and the statistics of the buffers of the topology to mw.
+func collectQueueMetrics(mw *MetricsWriter, labels Labels, snapshot StatsSnapshot, topology *Topology) {
+	for _, queue := range topology.Queues {
+		queueLabels := labels.with("queue", queue.Name)
+		qs := snapshot.QueueStats[queue.Name]
+		mw.Gauge("smo_queue_requests", "Number of requests currently in the buffer of the topology.", queueLabels, float64(queue.Buffer.Len()))
+		mw.Gauge("smo_queue_capacity", "Capacity of the buffer of the topology.", queueLabels, float64(queue.Buffer.Capacity))
+		mw.Counter("smo_queue_placed_requests_total", "Number of requests placed in the buffer of the topology.", queueLabels, float64(qs.Placed))
+		mw.Counter("smo_queue_spilled_requests_total", "Number of requests of the partition that spilled over to the shared region.", queueLabels, float64(qs.Spilled))
+		mw.Counter("smo_queue_taken_requests_total", "Number of requests taken from the buffer of the topology.", queueLabels, float64(qs.Taken))
+		mw.Counter("smo_queue_wait_time_seconds_total", "Total time the taken requests waited in the buffer of the topology.", queueLabels, qs.WaitTime.Seconds())
+	}
+}
+
+// collectPoolMetrics adds the live state and the statistics of the pools to mw.
+func collectPoolMetrics(mw *MetricsWriter, labels Labels, snapshot StatsSnapshot, pools []*Pool) {
+	for _, pool := range pools {
+		poolLabels := labels.with("pool", pool.Name)
+		processed, workTime := 0, time.Duration(0)
+		for _, specialist := range pool.Specialists {
+			processed += snapshot.SpecialistUsage[specialist.Id]
+			workTime += snapshot.SpecialistWorkTime[specialist.Id]
+		}
+		mw.Gauge("smo_pool_specialists", "Number of specialists in the pool.", poolLabels, float64(len(pool.Specialists)))
+		mw.Gauge("smo_pool_busy_specialists", "Number of specialists of the pool currently processing a request.", poolLabels, float64(countBusy(pool.Specialists)))
+		if pool.Buffer != nil {
+			mw.Gauge("smo_pool_buffer_requests", "Number of requests currently in the own buffer of the pool.", poolLabels, float64(pool.Buffer.Len()))
+		}
+		mw.Counter("smo_pool_requests_total", "Number of requests processed by the specialists of the pool.", poolLabels, float64(processed))
+		mw.Counter("smo_pool_work_time_seconds_total", "Total work time of the specialists of the pool.", poolLabels, workTime.Seconds())
+		mw.Counter("smo_pool_overflow_requests_total", "Number of requests of the pool sent to specialists of other pools.", poolLabels, float64(snapshot.PoolOverflows[pool.Name]))
+	}
+}
+
+// collectSkillMetrics adds the statistics of the skills to mw.
+func collectSkillMetrics(mw *MetricsWriter, labels Labels, snapshot StatsSnapshot, specialists []*Specialist) {
+	skills := make([]string, 0, len(snapshot.SkillStats))
+	for skill := range snapshot.SkillStats {
+		skills = append(skills, skill)
+	}
+	sort.Strings(skills)
+	for _, skill := range skills {
+		ss := snapshot.SkillStats[skill]
+		skillLabels := labels.with("skill", skill)
+		capable := 0
+		for _, specialist := range specialists {
+			if _, ok := specialist.Proficiency(skill); ok {
+				capable++
+			}
+		}
+		mw.Gauge("smo_skill_specialists", "Number of specialists able to serve requests that need the skill.", skillLabels, float64(capable))
+		mw.Counter("smo_skill_requests_total", "Number of requests that need the skill.", skillLabels, float64(ss.Requests))
+		mw.Counter("smo_skill_served_requests_total", "Number of processed requests that need the skill.", skillLabels, float64(ss.Served))
+		mw.Counter("smo_skill_overflowed_requests_total", "Number of requests sent to specialists less skilled than the primary ones.", skillLabels, float64(ss.Overflowed))
+		mw.Counter("smo_skill_wait_time_seconds_total", "Total time requests waited for a specialist with the skill.", skillLabels, ss.WaitTime.Seconds())
+		mw.Counter("smo_skill_work_time_seconds_total", "Total time specialists worked on requests that need the skill.", skillLabels, ss.WorkTime.Seconds())
+	}
+}
+
+func sortedKeys[V int | time.Duration](m map[int]V) []int {
+	keys := make([]int, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Ints(keys)
+	return keys
+}
@@ -0,0 +1,196 @@
+package requestsystem
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// exposedSample is a sample line of the text exposition.
+type exposedSample struct {
+	name   string
+	labels Labels
+	value  float64
+}
+
+// parseExposition parses the text exposition format and checks that every metric has one HELP
+// and one TYPE line before its samples. It returns the samples and the types of the metrics.
+func parseExposition(t *testing.T, r io.Reader) ([]exposedSample, map[string]string) {
+	t.Helper()
+	var samples []exposedSample
+	helps, types := make(map[string]bool), make(map[string]string)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if rest, ok := strings.CutPrefix(line, "# HELP "); ok {
+			name, help, _ := strings.Cut(rest, " ")
+			if helps[name] || help == "" {
+				t.Fatalf("repeated or empty HELP line %q", line)
+			}
+			helps[name] = true
+			continue
+		}
+		if rest, ok := strings.CutPrefix(line, "# TYPE "); ok {
+			name, kind, _ := strings.Cut(rest, " ")
+			if _, ok := types[name]; ok || !helps[name] || (kind != "counter" && kind != "gauge") {
+				t.Fatalf("TYPE line %q must follow one HELP line and name counter or gauge", line)
+			}
+			types[name] = kind
+			continue
+		}
+
+		sample := parseSample(t, line)
+		if _, ok := types[sample.name]; !ok {
+			t.Fatalf("sample %q comes before the TYPE line of its metric", line)
+		}
+		samples = append(samples, sample)
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return samples, types
+}
+
+// parseSample parses a line like name{a="1",b="x\"y"} 2 and unescapes the label values.
+func parseSample(t *testing.T, line string) exposedSample {
+	t.Helper()
+	end := strings.IndexAny(line, "{ ")
+	if end <= 0 {
+		t.Fatalf("malformed sample %q", line)
+	}
+	sample := exposedSample{name: line[:end], labels: Labels{}}
+	rest := line[end:]
+	if strings.HasPrefix(rest, "{") {
+		rest = rest[1:]
+		for !strings.HasPrefix(rest, "}") {
+			name, value, ok := strings.Cut(rest, `="`)
+			if !ok {
+				t.Fatalf("malformed labels in %q", line)
+			}
+			var b strings.Builder
+			i := 0
+			for ; i < len(value) && value[i] != '"'; i++ {
+				if value[i] != '\\' {
+					b.WriteByte(value[i])
+					continue
+				}
+				// В значениях экранируются только обратная косая черта, кавычка и перевод строки
+				i++
+				switch {
+				case i < len(value) && value[i] == 'n':
+					b.WriteByte('\n')
+				case i < len(value) && (value[i] == '\\' || value[i] == '"'):
+					b.WriteByte(value[i])
+				default:
+					t.Fatalf("bad escape in %q", line)
+				}
+			}
+			if i == len(value) {
+				t.Fatalf("unterminated label value in %q", line)
+			}
+			sample.labels[name] = b.String()
+			rest = strings.TrimPrefix(value[i+1:], ",")
+		}
+		rest = rest[1:]
+	}
+	value, err := strconv.ParseFloat(strings.TrimPrefix(rest, " "), 64)
+	if err != nil {
+		t.Fatalf("bad value in %q: %v", line, err)
+	}
+	sample.value = value
+	return sample
+}
+
+func TestMetricsExposition(t *testing.T) {
+	pool, err := NewWorkerPool(WorkerPoolConfig{
+		Workers:   1,
+		BufferCap: 1,
+		Handler: func(ctx context.Context, request *Request) error {
+			if request.Payload == "fail" {
+				return errors.New("failed")
+			}
+			return nil
+		},
+		StatsFile: filepath.Join(t.TempDir(), "stats.log"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool.Start(context.Background())
+	t.Cleanup(pool.Close)
+
+	// ID клиента проверяет экранирование всех трех особых символов
+	tricky := &Client{ID: "a \"quoted\" \\path\\\nline"}
+	plain := &Client{ID: "plain"}
+	for _, payload := range []string{"ok", "fail", "ok"} {
+		<-pool.Submit(tricky, payload).Done()
+	}
+	<-pool.Submit(plain, "ok").Done()
+	pool.Stop()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /metrics", func(w http.ResponseWriter, r *http.Request) {
+		mw := NewMetricsWriter()
+		pool.CollectMetrics(mw, Labels{"run": "1"})
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		mw.WriteTo(w)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	samples, types := parseExposition(t, resp.Body)
+
+	find := func(name string, labels Labels) float64 {
+		t.Helper()
+		for _, sample := range samples {
+			if sample.name == name && sample.labels.String() == labels.String() {
+				return sample.value
+			}
+		}
+		t.Fatalf("no sample %s%s", name, labels)
+		return 0
+	}
+
+	for name, kind := range types {
+		if strings.HasSuffix(name, "_total") != (kind == "counter") {
+			t.Errorf("metric %s has type %s", name, kind)
+		}
+	}
+
+	snapshot := pool.StatsManager.Snapshot()
+	run := Labels{"run": "1"}
+	counters := []struct {
+		name   string
+		labels Labels
+		want   int
+	}{
+		{"smo_requests_total", run, snapshot.TotalRequests},
+		{"smo_completed_requests_total", run, snapshot.CompletedRequests},
+		{"smo_failed_requests_total", run, snapshot.FailedRequests},
+		{"smo_rejected_requests_total", run, snapshot.RejectedRequests},
+		{"smo_client_requests_total", run.with("client", tricky.ID), snapshot.ClientStats[tricky.ID].Requests},
+		{"smo_client_failed_requests_total", run.with("client", tricky.ID), snapshot.ClientStats[tricky.ID].Failed},
+		{"smo_client_requests_total", run.with("client", plain.ID), snapshot.ClientStats[plain.ID].Requests},
+	}
+	for _, c := range counters {
+		if got := find(c.name, c.labels); got != float64(c.want) {
+			t.Errorf("%s%s = %v, want %d", c.name, c.labels, got, c.want)
+		}
+	}
+	if snapshot.TotalRequests != 4 || snapshot.ClientStats[tricky.ID].Failed != 1 {
+		t.Errorf("snapshot has %d requests and %d failed, want 4 and 1",
+			snapshot.TotalRequests, snapshot.ClientStats[tricky.ID].Failed)
+	}
+}
@@ -0,0 +1,108 @@
+package requestsystem
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// RetrialConfig describes the retrial orbit in the experiment config.
+type RetrialConfig struct {
+	Delay      DistributionConfig `json:"delay"`       // Интервал до повторной попытки
+	MaxRetries int                `json:"max_retries"` // Сколько раз клиент перезванивает, прежде чем сдаться
+}
+
+// Orbit holds rejected requests until their clients call back.
+// A request comes back after Delay and is placed again by Retry.
+type Orbit struct {
+	Delay        Distribution
+	MaxRetries   int
+	Retry        func(request *Request) // Повторно размещает заявку в системе
+	StatsManager *StatsManager          // Статистика повторных попыток, может быть nil
+	Events       *EventBus
+
+	requests map[*Request]*time.Timer
+	closed   bool
+	mu       sync.Mutex
+}
+
+// NewOrbit creates the orbit described by the config.
+func NewOrbit(cfg RetrialConfig) (*Orbit, error) {
+	if cfg.MaxRetries < 0 {
+		return nil, fmt.Errorf("max_retries must not be negative")
+	}
+	delay, err := cfg.Delay.Distribution()
+	if err != nil {
+		return nil, fmt.Errorf("delay: %w", err)
+	}
+	return &Orbit{
+		Delay:      delay,
+		MaxRetries: cfg.MaxRetries,
+		requests:   make(map[*Request]*time.Timer),
+	}, nil
+}
+
+// Add sends a rejected request to the orbit and reports whether the client will call back.
+// A nil or closed orbit and a request that used all its retries are not accepted.
+func (o *Orbit) Add(request *Request) bool {
+	if o == nil || request.Attempts > o.MaxRetries {
+		return false
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.closed {
+		return false
+	}
+	o.requests[request] = time.AfterFunc(o.Delay.Sample(), func() { o.release(request) })
+	if o.StatsManager != nil {
+		o.StatsManager.RecordOrbitEntry(request, len(o.requests))
+	}
+	o.Events.Publish(newRequestEvent(EventOrbit, request, 0))
+	return true
+}
+
+// release takes the request out of the orbit and places it again.
+func (o *Orbit) release(request *Request) {
+	o.mu.Lock()
+	if _, ok := o.requests[request]; !ok {
+		o.mu.Unlock()
+		return
+	}
+	delete(o.requests, request)
+	if o.StatsManager != nil {
+		o.StatsManager.RecordRetry(request, len(o.requests))
+	}
+	o.mu.Unlock()
+
+	o.Events.Publish(newRequestEvent(EventRetry, request, 0))
+	o.Retry(request)
+}
+
+// Len returns the number of requests in the orbit.
+func (o *Orbit) Len() int {
+	if o == nil {
+		return 0
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return len(o.requests)
+}
+
+// Close stops the retries and returns the requests left in the orbit.
+func (o *Orbit) Close() []*Request {
+	if o == nil {
+		return nil
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.closed = true
+	left := make([]*Request, 0, len(o.requests))
+	for request, timer := range o.requests {
+		timer.Stop()
+		left = append(left, request)
+	}
+	o.requests = make(map[*Request]*time.Timer)
+	return left
+}
@@ -0,0 +1,66 @@
+package requestsystem
+
+import (
+	"fmt"
+	"time"
+)
+
+// Pool is a named group of specialists. Requests of a pool wait in its own buffer or in the shared one
+// and may overflow to another pool.
+type Pool struct {
+	Name        string
+	Specialists []*Specialist
+	Buffer      *Buffer // Собственный буфер пула, nil - общий буфер системы
+
+	// Заявки пула уходят в пул Overflow, когда у пула нет свободных специалистов
+	// и заявка прождала не меньше OverflowAfter
+	Overflow      *Pool
+	OverflowAfter time.Duration
+}
+
+// PoolConfig describes a pool of specialists in the experiment config.
+type PoolConfig struct {
+	Name        string          `json:"name"`
+	Specialists int             `json:"specialists"`
+	Lambda      float64         `json:"lambda"`               // коэфф времени работы специалистов пула
+	BufferCap   int             `json:"buffer_cap,omitempty"` // Собственный буфер пула; 0 - общий буфер системы
+	Overflow    *OverflowConfig `json:"overflow,omitempty"`
+}
+
+// OverflowConfig describes when the work of a pool goes to another pool.
+type OverflowConfig struct {
+	To    string   `json:"to"`
+	After Duration `json:"after,omitempty"` // Сколько заявка ждет свой пул; 0 - уходит, как только заняты все его специалисты
+}
+
+// validatePools checks the pools of the config: unique names, existing overflow targets.
+func validatePools(pools []PoolConfig) error {
+	names := make(map[string]bool, len(pools))
+	for i, pc := range pools {
+		switch {
+		case pc.Name == "":
+			return fmt.Errorf("pool %d: name is required", i+1)
+		case names[pc.Name]:
+			return fmt.Errorf("pool %q is defined twice", pc.Name)
+		case pc.Specialists <= 0:
+			return fmt.Errorf("pool %q: specialists must be positive", pc.Name)
+		case pc.BufferCap < 0:
+			return fmt.Errorf("pool %q: buffer_cap must not be negative", pc.Name)
+		}
+		names[pc.Name] = true
+	}
+	for _, pc := range pools {
+		if pc.Overflow == nil {
+			continue
+		}
+		switch {
+		case !names[pc.Overflow.To]:
+			return fmt.Errorf("pool %q: unknown overflow pool %q", pc.Name, pc.Overflow.To)
+		case pc.Overflow.To == pc.Name:
+			return fmt.Errorf("pool %q overflows to itself", pc.Name)
+		case pc.Overflow.After < 0:
+			return fmt.Errorf("pool %q: overflow after must not be negative", pc.Name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,240 @@
+package requestsystem
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RatePoint is a point of an arrival rate profile.
+type RatePoint struct {
+	At   time.Duration // Смещение от начала профиля в модельном времени
+	Rate float64       // Заявок в секунду модельного времени
+}
+
+// RateProfile is an arrival rate that changes over time. Between the points the rate is
+// constant (a step) or changes linearly; before the first point it is the rate of the first point,
+// and a repeating profile continues the last segment of the previous period.
+type RateProfile struct {
+	Points []RatePoint // По возрастанию At
+	Linear bool        // Линейная интерполяция между точками вместо ступенек
+
+	// Профиль повторяется с этим периодом, например 24h для суточного профиля.
+	// 0 - после последней точки держится ее интенсивность
+	Period time.Duration
+}
+
+// Rate returns the arrival rate at the moment t of the profile.
+func (p *RateProfile) Rate(t time.Duration) float64 {
+	if p.Period > 0 {
+		t %= p.Period
+	}
+	points := p.Points
+	if t < points[0].At {
+		if p.Period == 0 {
+			return points[0].Rate
+		}
+		// Продолжается последний отрезок предыдущего периода
+		t += p.Period
+	}
+	for i := len(points) - 1; i >= 0; i-- {
+		if t < points[i].At {
+			continue
+		}
+		if !p.Linear {
+			return points[i].Rate
+		}
+		next := RatePoint{At: p.Period + points[0].At, Rate: points[0].Rate}
+		switch {
+		case i < len(points)-1:
+			next = points[i+1]
+		case p.Period == 0:
+			return points[i].Rate
+		}
+		// После последней точки повторяющийся профиль возвращается к первой точке следующего периода
+		share := float64(t-points[i].At) / float64(next.At-points[i].At)
+		return points[i].Rate + share*(next.Rate-points[i].Rate)
+	}
+	return points[0].Rate
+}
+
+// MaxRate returns the largest arrival rate of the profile.
+func (p *RateProfile) MaxRate() float64 {
+	max := 0.0
+	for _, point := range p.Points {
+		max = math.Max(max, point.Rate)
+	}
+	return max
+}
+
+// ends reports whether no requests arrive after the moment t of the profile.
+func (p *RateProfile) ends(t time.Duration) bool {
+	last := p.Points[len(p.Points)-1]
+	return p.Period == 0 && t >= last.At && last.Rate == 0
+}
+
+// ProfileArrival produces the intervals of a non-homogeneous Poisson flow whose rate follows
+// the profile. The profile starts with the first Sample and runs TimeScale times faster than
+// the real time, so a daily profile can be played in minutes.
+// Sample may be called concurrently, e.g. by several clients sharing the distribution.
+type ProfileArrival struct {
+	Profile   *RateProfile
+	TimeScale float64 // Секунд модельного времени за секунду работы
+
+	start time.Time
+	mu    sync.Mutex
+}
+
+// Sample returns the interval from now to the next arrival of the flow.
+// Arrivals are sampled by thinning: candidates come at the largest rate of the profile
+// and each of them is kept with the probability of the rate at its moment to the largest rate.
+func (d *ProfileArrival) Sample() time.Duration {
+	d.mu.Lock()
+	now := time.Now()
+	if d.start.IsZero() {
+		d.start = now
+	}
+	elapsed := now.Sub(d.start)
+	d.mu.Unlock()
+
+	max := d.Profile.MaxRate()
+	from := time.Duration(float64(elapsed) * d.TimeScale)
+	t := from
+	for {
+		if max == 0 || d.Profile.ends(t) {
+			// Заявок больше не будет
+			return math.MaxInt64
+		}
+		t += time.Duration(rand.ExpFloat64() / max * float64(time.Second))
+		if rand.Float64()*max <= d.Profile.Rate(t) {
+			return time.Duration(float64(t-from) / d.TimeScale)
+		}
+	}
+}
+
+// LoadRateProfile reads the points of a profile from a CSV file with the lines "offset,rate".
+// The offset is a duration like "9h30m" or a number of units, the rate is the number of requests
+// per unit, e.g. calls per hour with the unit 1h. A header line and lines starting with # are skipped.
+func LoadRateProfile(filename string, unit time.Duration) ([]RatePoint, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return readRateProfile(file, unit)
+}
+
+// readRateProfile reads the points of a profile in the format of LoadRateProfile.
+func readRateProfile(r io.Reader, unit time.Duration) ([]RatePoint, error) {
+	reader := csv.NewReader(r)
+	reader.Comment = '#'
+	reader.FieldsPerRecord = 2
+	reader.TrimLeadingSpace = true
+
+	var points []RatePoint
+	for first := true; ; first = false {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		line, _ := reader.FieldPos(0)
+
+		at, err := parseProfileOffset(record[0], unit)
+		if err != nil {
+			if first {
+				// Заголовок
+				continue
+			}
+			return nil, fmt.Errorf("line %d: offset: %w", line, err)
+		}
+		rate, err := strconv.ParseFloat(strings.TrimSpace(record[1]), 64)
+		switch {
+		case err != nil:
+			return nil, fmt.Errorf("line %d: rate: %w", line, err)
+		case rate < 0 || math.IsNaN(rate) || math.IsInf(rate, 0):
+			return nil, fmt.Errorf("line %d: rate must be a non-negative number", line)
+		case len(points) > 0 && at <= points[len(points)-1].At:
+			return nil, fmt.Errorf("line %d: offsets must increase", line)
+		}
+		points = append(points, RatePoint{At: at, Rate: rate / unit.Seconds()})
+	}
+	if len(points) == 0 {
+		return nil, fmt.Errorf("the profile has no points")
+	}
+	return points, nil
+}
+
+// parseProfileOffset parses an offset of a profile given as a duration or a number of units.
+func parseProfileOffset(s string, unit time.Duration) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	if units, err := strconv.ParseFloat(s, 64); err == nil {
+		if units < 0 {
+			return 0, fmt.Errorf("must not be negative")
+		}
+		return time.Duration(units * float64(unit)), nil
+	}
+	at, err := time.ParseDuration(s)
+	if err == nil && at < 0 {
+		return 0, fmt.Errorf("must not be negative")
+	}
+	return at, err
+}
+
+// Интерполяция профиля в конфигурации
+const (
+	InterpolationStep   = "step"
+	InterpolationLinear = "linear"
+)
+
+// profileArrival creates the arrival flow of the profile described by the config.
+func (dc DistributionConfig) profileArrival() (*ProfileArrival, error) {
+	if dc.Profile == "" {
+		return nil, fmt.Errorf("profile distribution: profile file is required")
+	}
+	unit := time.Duration(dc.Unit)
+	if unit == 0 {
+		unit = time.Second
+	}
+	switch {
+	case unit < 0:
+		return nil, fmt.Errorf("profile distribution: unit must be positive")
+	case dc.Period < 0:
+		return nil, fmt.Errorf("profile distribution: period must not be negative")
+	case dc.TimeScale < 0:
+		return nil, fmt.Errorf("profile distribution: time_scale must not be negative")
+	}
+
+	profile := &RateProfile{Period: time.Duration(dc.Period)}
+	switch dc.Interpolation {
+	case "", InterpolationStep:
+	case InterpolationLinear:
+		profile.Linear = true
+	default:
+		return nil, fmt.Errorf("profile distribution: unknown interpolation %q", dc.Interpolation)
+	}
+
+	points, err := LoadRateProfile(dc.Profile, unit)
+	if err != nil {
+		return nil, fmt.Errorf("profile distribution: %s: %w", dc.Profile, err)
+	}
+	if profile.Period > 0 && points[len(points)-1].At >= profile.Period {
+		return nil, fmt.Errorf("profile distribution: offsets must be less than the period")
+	}
+	profile.Points = points
+
+	scale := dc.TimeScale
+	if scale == 0 {
+		scale = 1
+	}
+	return &ProfileArrival{Profile: profile, TimeScale: scale}, nil
+}
@@ -0,0 +1,83 @@
+package requestsystem
+
+import (
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRateProfileRate(t *testing.T) {
+	points := []RatePoint{{At: time.Hour, Rate: 10}, {At: 2 * time.Hour, Rate: 20}, {At: 4 * time.Hour, Rate: 0}}
+	tests := []struct {
+		name   string
+		linear bool
+		period time.Duration
+		t      time.Duration
+		want   float64
+	}{
+		{"step before first point", false, 0, 0, 10},
+		{"step at point", false, 0, time.Hour, 10},
+		{"step before next point", false, 0, 2*time.Hour - time.Nanosecond, 10},
+		{"step at next point", false, 0, 2 * time.Hour, 20},
+		{"step after last point", false, 0, 5 * time.Hour, 0},
+		{"linear between points", true, 0, 90 * time.Minute, 15},
+		{"linear going down", true, 0, 3 * time.Hour, 10},
+		{"linear before first point", true, 0, 0, 10},
+		{"linear after last point", true, 0, 10 * time.Hour, 0},
+		{"step wraps to next period", false, 6 * time.Hour, 7 * time.Hour, 10},
+		{"step before first point continues previous period", false, 6 * time.Hour, 30 * time.Minute, 0},
+		{"linear after last point goes to first of next period", true, 6 * time.Hour, 5 * time.Hour, 10.0 / 3},
+		{"linear wraps before first point", true, 6 * time.Hour, 30 * time.Minute, 25.0 / 3},
+		{"linear at period start", true, 6 * time.Hour, 6 * time.Hour, 20.0 / 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &RateProfile{Points: points, Linear: tt.linear, Period: tt.period}
+			if got := p.Rate(tt.t); math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("Rate(%v) = %v, want %v", tt.t, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadRateProfile(t *testing.T) {
+	tests := []struct {
+		name    string
+		csv     string
+		unit    time.Duration
+		want    []RatePoint
+		wantErr string
+	}{
+		{"header and units", "offset,rate\n0,60\n1.5,120\n", time.Minute,
+			[]RatePoint{{At: 0, Rate: 1}, {At: 90 * time.Second, Rate: 2}}, ""},
+		{"durations and comments", "# calls per hour\n0h, 3600\n9h30m, 7200\n", time.Hour,
+			[]RatePoint{{At: 0, Rate: 1}, {At: 9*time.Hour + 30*time.Minute, Rate: 2}}, ""},
+		{"empty", "", time.Second, nil, "no points"},
+		{"header only", "offset,rate\n", time.Second, nil, "no points"},
+		{"bad offset", "0,1\nsoon,2\n", time.Second, nil, "line 2: offset"},
+		{"negative offset", "0,1\n-1,2\n", time.Second, nil, "line 2: offset"},
+		{"bad rate", "0,many\n", time.Second, nil, "line 1: rate"},
+		{"negative rate", "0,-1\n", time.Second, nil, "line 1: rate must be a non-negative number"},
+		{"offsets must increase", "0,1\n1,2\n1,3\n", time.Second, nil, "line 3: offsets must increase"},
+		{"wrong number of fields", "0,1,2\n", time.Second, nil, "wrong number of fields"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := readRateProfile(strings.NewReader(tt.csv), tt.unit)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("readRateProfile() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("readRateProfile() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
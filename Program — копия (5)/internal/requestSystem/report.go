@@ -2,12 +2,25 @@ package requestsystem
 
 import (
 	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
 	"time"
 )
 
 // ReportManager отвечает за формирование и вывод отчетов
 type ReportManager struct {
 	StatsManager *StatsManager
+	Out          io.Writer // Куда печатаются текстовые отчеты; nil - в стандартный вывод
+}
+
+// out returns the writer of the text reports.
+func (rm *ReportManager) out() io.Writer {
+	if rm.Out == nil {
+		return os.Stdout
+	}
+	return rm.Out
 }
 
 // NewReportManager создает новый ReportManager
@@ -19,31 +32,297 @@ func NewReportManager(statsManager *StatsManager) *ReportManager {
 
 // GenerateSpecialistReport генерирует отчет по каждому специалисту
 func (rm *ReportManager) GenerateSpecialistReport(specialists []*Specialist, createdAtTimes []time.Time) {
-	fmt.Println("Stats for Specialists:")
-	fmt.Printf("%-5s %-15s %-15s %-20s %-15s %-15s\n", "ID", "WorkTime", "Lambda", "ProcessedRequests", "LoadPercentage", "LoadPercentageByTime")
+	snapshot := rm.StatsManager.Snapshot()
+
+	fmt.Fprintln(rm.out(), "Stats for Specialists:")
+	fmt.Fprintf(rm.out(), "%-5s %-15s %-15s %-20s %-15s %-15s\n", "ID", "WorkTime", "Lambda", "ProcessedRequests", "LoadPercentage", "LoadPercentageByTime")
 
 	for _, specialist := range specialists {
-		workTime := specialist.WorkTime
-		lambda := specialist.Lambda
-		processedRequests := specialist.ProcessedRequestsCount
-		loadPercentage := float64(processedRequests) / float64(rm.StatsManager.TotalRequests-rm.StatsManager.RejectedRequests) * 100
-		// specialistWorkTimeRatio := float64(sm.SpecialistWorkTime[i]) / float64(time.Since(createdAtTimes[i-1]))
-		LoadPercentageByTime := float64(rm.StatsManager.SpecialistWorkTime[specialist.Id-1]) / float64(time.Since(createdAtTimes[specialist.Id-1]))
+		state := specialist.Snapshot()
+		processedRequests := state.ProcessedRequestsCount
+		loadPercentage := 0.0
+		if served := snapshot.TotalRequests - snapshot.RejectedRequests - snapshot.AbandonedRequests - snapshot.BalkedRequests - snapshot.ThrottledRequests; served > 0 {
+			loadPercentage = float64(processedRequests) / float64(served) * 100
+		}
+		LoadPercentageByTime := float64(snapshot.SpecialistWorkTime[state.Id]) / float64(time.Since(createdAtTimes[state.Id-1]))
 
-		fmt.Printf("%-5d %-15s %-15.4f %-20d %-15.2f%-15.2f%%\n", specialist.Id, workTime, lambda, processedRequests, loadPercentage, LoadPercentageByTime)
+		fmt.Fprintf(rm.out(), "%-5d %-15s %-15.4f %-20d %-15.2f%-15.2f%%\n", state.Id, state.WorkTime, state.Lambda, processedRequests, loadPercentage, LoadPercentageByTime)
 	}
 }
 
 // GenerateSystemReport генерирует отчет по системе
 func (rm *ReportManager) GenerateSystemReport() {
-	fmt.Println("\nStats for System:")
-	fmt.Printf("%-20s %-20s %-20s %-20s %-20s\n", "TotalRequests", "RejectedRequests", "TotalBufferTime", "TotalProcessingTime", "TotalSystemTime")
+	snapshot := rm.StatsManager.Snapshot()
+
+	fmt.Fprintln(rm.out(), "\nStats for System:")
+	fmt.Fprintf(rm.out(), "%-20s %-20s %-20s %-20s %-20s %-20s %-20s %-20s %-20s %-20s %-20s %-20s %-20s\n", "TotalRequests", "RejectedRequests", "TotalBufferTime", "TotalProcessingTime", "TotalSystemTime",
+		"CompletedRequests", "FailedRequests", "TimedOutRequests", "InterruptedRequests", "AbandonedRequests", "Abandonment", "BalkedRequests", "Balking")
+
+	fmt.Fprintf(rm.out(), "%-20d %-20d %-20s %-20s %-20s %-20d %-20d %-20d %-20d %-20d %-20.4f %-20d %-20.4f\n", snapshot.TotalRequests, snapshot.RejectedRequests, snapshot.TotalBufferTime,
+		snapshot.TotalProcessingTime, snapshot.TotalSystemTime,
+		snapshot.CompletedRequests, snapshot.FailedRequests, snapshot.TimedOutRequests, snapshot.InterruptedRequests,
+		snapshot.AbandonedRequests, snapshot.ProbabilityOfAbandon, snapshot.BalkedRequests, snapshot.ProbabilityOfBalking)
+}
+
+// GenerateAdmissionReport генерирует отчет по ограничению скорости клиентов: отказы лимита отдельно от переполнения буфера
+func (rm *ReportManager) GenerateAdmissionReport() {
+	snapshot := rm.StatsManager.Snapshot()
+
+	fmt.Fprintln(rm.out(), "\nStats for Admission Control:")
+	fmt.Fprintf(rm.out(), "%-20s %-20s %-20s %-20s %-25s %-20s\n", "ThrottledRequests", "Throttling", "RejectedByBuffer", "DelayedRequests",
+		"AvgAdmissionDelay(ms)", "ProbabilityOfLoss")
+	fmt.Fprintf(rm.out(), "%-20d %-20.4f %-20d %-20d %-25.2f %-20.4f\n", snapshot.ThrottledRequests, snapshot.ProbabilityOfThrottle, snapshot.RejectedRequests,
+		snapshot.DelayedRequests, snapshot.AverageAdmissionDelay, snapshot.ProbabilityOfLoss)
+
+	fmt.Fprintf(rm.out(), "%-15s %-15s %-15s %-15s %-25s %-20s\n", "ID", "Requests", "Throttled", "Delayed", "AvgAdmissionDelay(ms)", "RejectedByBuffer")
+	for _, id := range sortedClientIDs(snapshot) {
+		cs := snapshot.ClientStats[id]
+		fmt.Fprintf(rm.out(), "%-15s %-15d %-15d %-15d %-25.2f %-20d\n", id, cs.Requests, cs.Throttled, cs.Delayed, cs.AverageAdmissionDelay(), cs.Rejected)
+	}
+}
+
+// GenerateRetrialReport генерирует отчет по орбите повторных попыток
+func (rm *ReportManager) GenerateRetrialReport() {
+	snapshot := rm.StatsManager.Snapshot()
+
+	fmt.Fprintln(rm.out(), "\nStats for Retrial Orbit:")
+	fmt.Fprintf(rm.out(), "%-25s %-25s %-20s %-20s %-20s %-20s\n", "FirstAttemptRejections", "FirstAttemptRejection", "RetryAttempts", "AverageAttempts",
+		"LeftInOrbit", "ProbabilityOfLoss")
+	fmt.Fprintf(rm.out(), "%-25d %-25.4f %-20d %-20.4f %-20d %-20.4f\n", snapshot.FirstAttemptRejections, snapshot.ProbabilityOfFirstRej, snapshot.RetryAttempts,
+		snapshot.AverageAttempts, snapshot.OrbitSize, snapshot.ProbabilityOfLoss)
+
+	fmt.Fprintf(rm.out(), "%-10s %-10s\n", "Attempts", "Requests")
+	for _, attempts := range sortedKeys(snapshot.Attempts) {
+		fmt.Fprintf(rm.out(), "%-10d %-10d\n", attempts, snapshot.Attempts[attempts])
+	}
+}
+
+// GenerateClientReport генерирует отчет по каждому клиенту
+func (rm *ReportManager) GenerateClientReport() {
+	snapshot := rm.StatsManager.Snapshot()
+	ids := sortedClientIDs(snapshot)
+
+	fmt.Fprintln(rm.out(), "\nStats for Clients:")
+	fmt.Fprintf(rm.out(), "%-15s %-15s %-15s %-15s %-15s %-15s %-15s %-15s %-15s %-15s\n", "ID", "Requests", "Rejected", "Completed", "Failed", "Abandoned", "Balked",
+		"Rejection", "Abandonment", "Balking")
+	for _, id := range ids {
+		cs := snapshot.ClientStats[id]
+		fmt.Fprintf(rm.out(), "%-15s %-15d %-15d %-15d %-15d %-15d %-15d %-15.4f %-15.4f %-15.4f\n", id, cs.Requests, cs.Rejected, cs.Completed, cs.Failed, cs.Abandoned, cs.Balked,
+			cs.share(cs.Rejected), cs.share(cs.Abandoned), cs.share(cs.Balked))
+	}
+}
 
-	totalRequests := rm.StatsManager.TotalRequests
-	rejectedRequests := rm.StatsManager.RejectedRequests
-	totalBufferTime := rm.StatsManager.TotalBufferTime
-	totalProcessingTime := rm.StatsManager.TotalProcessingTime
-	totalSystemTime := rm.StatsManager.TotalSystemTime
+// GenerateFairnessReport генерирует отчет о справедливости обслуживания клиентов: пропускную способность
+// и ожидание каждого клиента и индекс Джайна по ним. weights - веса клиентов, nil - все веса равны 1
+func (rm *ReportManager) GenerateFairnessReport(weights map[string]float64) {
+	snapshot := rm.StatsManager.Snapshot()
 
-	fmt.Printf("%-20d %-20d %-20s %-20s %-20s\n", totalRequests, rejectedRequests, totalBufferTime, totalProcessingTime, totalSystemTime)
+	fmt.Fprintln(rm.out(), "\nFairness between Clients:")
+	fmt.Fprintf(rm.out(), "%-15s %-15s %-15s %-15s %-20s\n", "ID", "Weight", "Completed", "Throughput(1/s)", "AvgWaitTime(ms)")
+	for _, id := range sortedClientIDs(snapshot) {
+		cs := snapshot.ClientStats[id]
+		weight := 1.0
+		if w, ok := weights[id]; ok {
+			weight = w
+		}
+		throughput := 0.0
+		if snapshot.TotalSystemTime > 0 {
+			throughput = float64(cs.Completed) / snapshot.TotalSystemTime.Seconds()
+		}
+		fmt.Fprintf(rm.out(), "%-15s %-15.2f %-15d %-15.3f %-20.2f\n", id, weight, cs.Completed, throughput, cs.AverageWaitTime())
+	}
+	throughputIndex, waitIndex := snapshot.Fairness(weights)
+	fmt.Fprintf(rm.out(), "Jain's index of weighted throughput: %.4f\n", throughputIndex)
+	fmt.Fprintf(rm.out(), "Jain's index of wait time: %.4f\n", waitIndex)
+}
+
+// GenerateClosedLoopReport генерирует отчет по клиентам замкнутой модели: эффективную интенсивность поступления
+// за время генерации generation, время отклика и среднее число заявок клиента в системе по формуле Литтла
+func (rm *ReportManager) GenerateClosedLoopReport(clients []*Client, generation time.Duration) {
+	snapshot := rm.StatsManager.Snapshot()
+
+	fmt.Fprintln(rm.out(), "\nStats for Closed-Loop Clients:")
+	fmt.Fprintf(rm.out(), "%-10s %-12s %-12s %-20s %-12s %-20s %-15s\n", "ID", "Outstanding", "Requests", "ArrivalRate(1/s)", "Completed",
+		"AvgResponseTime(ms)", "AvgInSystem")
+	totalRate := 0.0
+	for _, client := range clients {
+		cs := snapshot.ClientStats[client.ID]
+		rate := 0.0
+		if generation > 0 {
+			rate = float64(cs.Requests) / generation.Seconds()
+		}
+		totalRate += rate
+		inSystem := rate * cs.AverageResponseTime() / 1e3
+		fmt.Fprintf(rm.out(), "%-10s %-12d %-12d %-20.3f %-12d %-20.2f %-15.3f\n", client.ID, client.Outstanding, cs.Requests, rate, cs.Completed,
+			cs.AverageResponseTime(), inSystem)
+	}
+	fmt.Fprintf(rm.out(), "Effective arrival rate of the system: %.3f 1/s\n", totalRate)
+}
+
+// sortedClientIDs returns the IDs of the clients of the snapshot in the order of their numbers.
+func sortedClientIDs(snapshot StatsSnapshot) []string {
+	ids := make([]string, 0, len(snapshot.ClientStats))
+	for id := range snapshot.ClientStats {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		return lessClientID(ids[i], ids[j])
+	})
+	return ids
+}
+
+// GenerateClassReport генерирует отчет по каждому классу заявок
+func (rm *ReportManager) GenerateClassReport() {
+	snapshot := rm.StatsManager.Snapshot()
+	names := make([]string, 0, len(snapshot.ClassStats))
+	for name := range snapshot.ClassStats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintln(rm.out(), "\nStats for Request Classes:")
+	fmt.Fprintf(rm.out(), "%-15s %-10s %-10s %-10s %-10s %-10s %-12s %-10s %-10s %-10s %-12s %-18s %-22s %-18s %-12s %-12s\n", "Class", "Requests", "Rejected",
+		"Completed", "Failed", "TimedOut", "Interrupted", "Abandoned", "Balked", "Preempted", "Rejection", "AvgBufferTime(ms)", "AvgProcessingTime(ms)",
+		"AvgResponse(ms)", "SLA", "WithinSLA")
+	for _, name := range names {
+		cs := snapshot.ClassStats[name]
+		rejection := 0.0
+		if cs.Requests > 0 {
+			rejection = float64(cs.Rejected) / float64(cs.Requests)
+		}
+		sla, withinSLA := "-", "-"
+		if cs.SLA > 0 {
+			sla = cs.SLA.String()
+			withinSLA = fmt.Sprintf("%.4f", cs.SLAAttainment())
+		}
+		fmt.Fprintf(rm.out(), "%-15s %-10d %-10d %-10d %-10d %-10d %-12d %-10d %-10d %-10d %-12.4f %-18.3f %-22.3f %-18.3f %-12s %-12s\n", name, cs.Requests, cs.Rejected,
+			cs.Completed, cs.Failed, cs.TimedOut, cs.Interrupted, cs.Abandoned, cs.Balked, cs.Preempted, rejection, cs.AverageBufferTime(), cs.AverageProcessingTime(),
+			cs.AverageResponseTime(), sla, withinSLA)
+	}
+}
+
+// GenerateSkillReport генерирует отчет по каждому навыку: загрузку специалистов, владеющих навыком,
+// и ожидание заявок, которым нужен навык
+func (rm *ReportManager) GenerateSkillReport(specialists []*Specialist) {
+	snapshot := rm.StatsManager.Snapshot()
+	skills := make([]string, 0, len(snapshot.SkillStats))
+	for skill := range snapshot.SkillStats {
+		skills = append(skills, skill)
+	}
+	sort.Strings(skills)
+
+	fmt.Fprintln(rm.out(), "\nStats for Skills:")
+	fmt.Fprintf(rm.out(), "%-15s %-12s %-10s %-10s %-10s %-12s %-15s %-20s %-12s\n", "Skill", "Specialists", "Requests", "Served", "Unserved", "Overflowed",
+		"AvgWait(ms)", "WorkTime", "Utilization")
+	for _, skill := range skills {
+		ss := snapshot.SkillStats[skill]
+		capable := 0
+		for _, specialist := range specialists {
+			if _, ok := specialist.Proficiency(skill); ok {
+				capable++
+			}
+		}
+		utilization := 0.0
+		if capable > 0 && snapshot.TotalSystemTime > 0 {
+			utilization = float64(ss.WorkTime) / float64(snapshot.TotalSystemTime) / float64(capable)
+		}
+		fmt.Fprintf(rm.out(), "%-15s %-12d %-10d %-10d %-10d %-12d %-15.3f %-20s %-12.4f\n", skill, capable, ss.Requests, ss.Served, ss.Unserved(), ss.Overflowed,
+			ss.AverageWaitTime(), ss.WorkTime, utilization)
+	}
+}
+
+// GeneratePoolReport генерирует отчет по каждому пулу специалистов: загрузку и пропускную способность
+func (rm *ReportManager) GeneratePoolReport(pools []*Pool) {
+	snapshot := rm.StatsManager.Snapshot()
+
+	fmt.Fprintln(rm.out(), "\nStats for Pools:")
+	fmt.Fprintf(rm.out(), "%-15s %-12s %-12s %-15s %-20s %-12s %-12s %-12s\n", "Pool", "Specialists", "Processed", "Throughput(1/s)", "WorkTime",
+		"Utilization", "OverflowOut", "Buffered")
+	for _, pool := range pools {
+		processed, workTime := 0, time.Duration(0)
+		for _, specialist := range pool.Specialists {
+			processed += snapshot.SpecialistUsage[specialist.Id]
+			workTime += snapshot.SpecialistWorkTime[specialist.Id]
+		}
+		throughput, utilization := 0.0, 0.0
+		if snapshot.TotalSystemTime > 0 {
+			throughput = float64(processed) / snapshot.TotalSystemTime.Seconds()
+			utilization = float64(workTime) / float64(snapshot.TotalSystemTime) / float64(len(pool.Specialists))
+		}
+		buffered := "shared"
+		if pool.Buffer != nil {
+			buffered = strconv.Itoa(pool.Buffer.Len())
+		}
+		fmt.Fprintf(rm.out(), "%-15s %-12d %-12d %-15.3f %-20s %-12.4f %-12d %-12s\n", pool.Name, len(pool.Specialists), processed, throughput, workTime,
+			utilization, snapshot.PoolOverflows[pool.Name], buffered)
+	}
+}
+
+// GenerateQueueReport генерирует отчет по каждому буферу топологии, чтобы сравнить ожидание шумных и тихих источников
+func (rm *ReportManager) GenerateQueueReport(topology *Topology) {
+	snapshot := rm.StatsManager.Snapshot()
+
+	fmt.Fprintf(rm.out(), "\nStats for Queues (%s, %s):\n", topology.Kind, topology.Selection)
+	fmt.Fprintf(rm.out(), "%-10s %-10s %-10s %-10s %-10s %-10s %-10s %-20s\n", "Queue", "Capacity", "Priority", "Weight", "Placed", "Spilled", "Taken",
+		"AvgWaitTime(ms)")
+	for _, queue := range topology.Queues {
+		qs := snapshot.QueueStats[queue.Name]
+		fmt.Fprintf(rm.out(), "%-10s %-10d %-10d %-10d %-10d %-10d %-10d %-20.2f\n", queue.Name, queue.Buffer.Capacity, queue.Priority, queue.Weight,
+			qs.Placed, qs.Spilled, qs.Taken, qs.AverageWaitTime())
+	}
+}
+
+// GenerateWindowReport генерирует отчет по окнам времени, чтобы нехватка специалистов в часы пик
+// не терялась в средних за весь эксперимент
+func (rm *ReportManager) GenerateWindowReport(specialists int) {
+	snapshot := rm.StatsManager.Snapshot()
+
+	fmt.Fprintf(rm.out(), "\nStats for Time Windows (%s):\n", snapshot.WindowSize)
+	fmt.Fprintf(rm.out(), "%-20s %-10s %-18s %-10s %-10s %-18s %-18s %-22s %-12s %-10s\n", "Window", "Requests", "ArrivalRate(1/s)", "Completed",
+		"Lost", "ProbabilityOfLoss", "AvgWaitTime(ms)", "AvgResponseTime(ms)", "Utilization", "MaxQueue")
+	peak, worst := -1, -1
+	for i, ws := range snapshot.Windows {
+		window := fmt.Sprintf("%s-%s", ws.Start, ws.Start+ws.Duration)
+		fmt.Fprintf(rm.out(), "%-20s %-10d %-18.3f %-10d %-10d %-18.4f %-18.2f %-22.2f %-12.4f %-10d\n", window, ws.Requests, ws.ArrivalRate(), ws.Completed,
+			ws.Lost(), ws.ProbabilityOfLoss(), ws.AverageWaitTime(), ws.AverageResponseTime(), ws.Utilization(specialists), ws.MaxOccupancy)
+		if ws.Duration < snapshot.WindowSize && i > 0 {
+			// Короткое последнее окно не сравнивается с полными
+			continue
+		}
+		if peak < 0 || ws.ArrivalRate() > snapshot.Windows[peak].ArrivalRate() {
+			peak = i
+		}
+		if worst < 0 || ws.ProbabilityOfLoss() > snapshot.Windows[worst].ProbabilityOfLoss() {
+			worst = i
+		}
+	}
+	if peak >= 0 {
+		ws := snapshot.Windows[peak]
+		fmt.Fprintf(rm.out(), "Peak arrival rate: %.3f 1/s from %s, utilization %.4f, probability of loss %.4f\n", ws.ArrivalRate(), ws.Start,
+			ws.Utilization(specialists), ws.ProbabilityOfLoss())
+		ws = snapshot.Windows[worst]
+		fmt.Fprintf(rm.out(), "Highest probability of loss: %.4f from %s, arrival rate %.3f 1/s\n", ws.ProbabilityOfLoss(), ws.Start, ws.ArrivalRate())
+	}
+}
+
+// GenerateTimelineReports выводит ASCII-таймлайн специалистов и сохраняет его в виде SVG и trace-event JSON
+func (rm *ReportManager) GenerateTimelineReports(timeline *Timeline, svgFilename, traceFilename string) error {
+	fmt.Fprintln(rm.out())
+	fmt.Fprint(rm.out(), timeline.ASCII(100))
+
+	svgFile, err := os.Create(svgFilename)
+	if err != nil {
+		return err
+	}
+	defer svgFile.Close()
+	if err := timeline.WriteSVG(svgFile); err != nil {
+		return err
+	}
+
+	traceFile, err := os.Create(traceFilename)
+	if err != nil {
+		return err
+	}
+	defer traceFile.Close()
+	return timeline.WriteTraceEvents(traceFile)
 }
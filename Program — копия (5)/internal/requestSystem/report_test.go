@@ -0,0 +1,52 @@
+package requestsystem
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestClientReportsShowAbandonment(t *testing.T) {
+	sm := newTestStatsManager(t, 1)
+	patient, impatient := &Client{ID: "1"}, &Client{ID: "<2>"}
+	var last *Request
+	for _, client := range []*Client{patient, impatient, impatient} {
+		last = client.SubmitRequest("Test")
+		sm.RecordRequest(last)
+	}
+	sm.RecordAbandonedRequest(last)
+
+	var text strings.Builder
+	rm := NewReportManager(sm)
+	rm.Out = &text
+	rm.GenerateClientReport()
+	if fields := strings.Fields(lineOf(t, text.String(), "<2>")); fields[5] != "1" || fields[8] != "0.5000" {
+		t.Errorf("client <2>: Abandoned %s, Abandonment %s; want 1, 0.5000", fields[5], fields[8])
+	}
+
+	filename := filepath.Join(t.TempDir(), "report.html")
+	if err := rm.GenerateHTMLReport(filename); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "<tr><td>&lt;2&gt;</td><td>2</td><td>0</td><td>0</td><td>1</td><td>0.5000</td>"
+	if !strings.Contains(string(data), want) {
+		t.Errorf("HTML report has no row %q", want)
+	}
+}
+
+// lineOf returns the line of the text that starts with prefix.
+func lineOf(t *testing.T, text, prefix string) string {
+	t.Helper()
+	for _, line := range strings.Split(text, "\n") {
+		if strings.HasPrefix(line, prefix) {
+			return line
+		}
+	}
+	t.Fatalf("no line starts with %q in\n%s", prefix, text)
+	return ""
+}
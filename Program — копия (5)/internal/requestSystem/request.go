@@ -1,12 +1,43 @@
 package requestsystem
 
-import "time"
+import (
+	"sync"
+	"time"
+)
 
 type Request struct {
 	ID        int
 	Client    *Client
 	Status    string
-	CreatedAt time.Time // Время создания заявки
+	Type      string        // Тип заявки, переданный клиентом
+	Class     *RequestClass // Класс заявки, nil - заявка без класса
+	CreatedAt time.Time     // Время создания заявки
+	Payload   interface{}   // Данные заявки для обработчика специалиста
+	Err       error         // Ошибка обработчика, если обработка завершилась неудачно
+	Attempts  int           // Сколько раз заявка поступала в систему, включая повторные попытки из орбиты
+
+	pool       *Pool         // Пул специалистов, куда поступила заявка; nil - пулов нет
+	bufferSlot int           // Слот в буфере, где лежит заявка; проверяется буфером под его мьютексом
+	bufferedAt time.Time     // Время, когда заявка последний раз попала в буфер
+	remaining  time.Duration // Оставшееся время обслуживания прерванной заявки, 0 - обслуживание сначала
+
+	done      chan struct{} // Закрывается, когда заявка покидает систему
+	leaveOnce sync.Once
+}
+
+// Done returns the channel that is closed when the request leaves the system: it was processed,
+// or it was rejected, abandoned, balked or throttled. A request waiting in the orbit has not left.
+func (r *Request) Done() <-chan struct{} {
+	return r.done
+}
+
+// leave marks that the request has left the system. Only the first call has an effect.
+func (r *Request) leave() {
+	r.leaveOnce.Do(func() {
+		if r.done != nil {
+			close(r.done)
+		}
+	})
 }
 
 // getId returns the ID of the request.
@@ -14,6 +45,30 @@ func (r *Request) GetId() int {
 	return r.ID
 }
 
+// ClassName returns the name of the class of the request, or its type if it has no class.
+func (r *Request) ClassName() string {
+	if r.Class != nil {
+		return r.Class.Name
+	}
+	return r.Type
+}
+
+// Priority returns the priority of the class of the request, 0 for a request without a class.
+func (r *Request) Priority() int {
+	if r.Class != nil {
+		return r.Class.Priority
+	}
+	return 0
+}
+
+// Skill returns the skill needed to serve the request, "" if any specialist can serve it.
+func (r *Request) Skill() string {
+	if r.Class != nil {
+		return r.Class.Skill
+	}
+	return ""
+}
+
 // updateStatus updates the status of the request.
 func (r *Request) UpdateStatus(status string) {
 	r.Status = status
@@ -1,102 +1,259 @@
 package requestsystem
 
 import (
-	"fmt"
+	"context"
 	"math/rand"
 	"sync"
 	"time"
 )
 
-// StartRequestGeneration запускает горутину для генерации заявок с ограничением по времени
-func StartRequestGeneration(clients []*Client, stagingManager *StagingManager, retrievalManager *RetrievalManager, wg *sync.WaitGroup, lamb float64, statsManager *StatsManager, duration time.Duration, pauseTime time.Duration) {
+// PlaceRequest sends a new request to an available specialist or, if all are busy, to the buffer.
+// It returns the request that left the system without processing: the request displaced
+// from the full buffer, which is recorded as rejected unless it went to the orbit,
+// or the request itself if its client balked or went over its rate limit.
+// A request delayed by the rate limit is placed later by the admission control.
+func PlaceRequest(request *Request, stagingManager *StagingManager, retrievalManager *RetrievalManager, statsManager *StatsManager) *Request {
+	// Записываем статистику о новой заявке
+	statsManager.RecordRequest(request)
+
+	// Заявка сверх лимита клиента не доходит до буфера: отклоняется или ждет допуска
+	switch stagingManager.Admission.Admit(request) {
+	case AdmitThrottled:
+		return request
+	case AdmitHeld:
+		return nil
+	}
+	return AdmitRequest(request, stagingManager, retrievalManager, statsManager)
+}
+
+// AdmitRequest places a request let in by the admission control. The result is the same as of PlaceRequest.
+func AdmitRequest(request *Request, stagingManager *StagingManager, retrievalManager *RetrievalManager, statsManager *StatsManager) *Request {
+	retrievalManager.AssignPool(request)
+	stagingManager.InitiatePlacement(request)
+	return placeAttempt(request, stagingManager, retrievalManager, statsManager)
+}
+
+// RetryRequest places a request that came back from the orbit. The result is the same as of PlaceRequest.
+func RetryRequest(request *Request, stagingManager *StagingManager, retrievalManager *RetrievalManager, statsManager *StatsManager) *Request {
+	return placeAttempt(request, stagingManager, retrievalManager, statsManager)
+}
+
+// ReturnRequest places a preempted request: it goes to a free specialist or back to the head of the buffer.
+// It is not a new attempt and the client does not balk, because the request has already been admitted.
+// The result is the same as of PlaceRequest.
+func ReturnRequest(request *Request, stagingManager *StagingManager, retrievalManager *RetrievalManager, statsManager *StatsManager) *Request {
+	if retrievalManager.DispatchRequest(request) {
+		return nil
+	}
+	displaced := stagingManager.ReturnRequestBuffer(request)
+	return dropDisplaced(request, displaced, stagingManager, retrievalManager, statsManager)
+}
+
+// placeAttempt makes one attempt to place the request.
+func placeAttempt(request *Request, stagingManager *StagingManager, retrievalManager *RetrievalManager, statsManager *StatsManager) *Request {
+	request.Attempts++
+	if retrievalManager.DispatchRequest(request) {
+		return nil
+	}
+	// Заявка с большим приоритетом может прервать обслуживание менее важной
+	if retrievalManager.Preempt(request) {
+		return nil
+	}
+
+	// Клиент видит очередь и может отказаться в нее вставать
+	if stagingManager.Balks(request, len(retrievalManager.Specialists)) {
+		return request
+	}
+
+	// Добавляем заявку в буфер
+	displaced := stagingManager.AddRequestBuffer(request)
+	return dropDisplaced(request, displaced, stagingManager, retrievalManager, statsManager)
+}
+
+// dropDisplaced sends the request displaced from the buffer by request to the orbit or records it as rejected,
+// and wakes the dispatcher. It returns the displaced request unless it went to the orbit.
+func dropDisplaced(request, displaced *Request, stagingManager *StagingManager, retrievalManager *RetrievalManager, statsManager *StatsManager) *Request {
+	if displaced != nil {
+		if stagingManager.Orbit.Add(displaced) {
+			// Клиент перезвонит позже
+			displaced = nil
+		} else {
+			// Если буфер полон, записываем вытесненную заявку как отклоненную
+			statsManager.RecordRejectedRequest(displaced)
+			displaced.leave()
+		}
+	}
+	// Специалист мог освободиться после DispatchRequest, будим диспетчер
+	if displaced != request {
+		retrievalManager.notifyBuffered(request)
+	} else {
+		retrievalManager.Notify()
+	}
+	return displaced
+}
+
+// StartRequestGeneration запускает горутину для генерации заявок с ограничением по времени или до отмены ctx
+// Каждый клиент генерирует заявки своими процессами независимо от остальных, с момента Start до Stop:
+// клиенты замкнутой модели - Outstanding циклами, клиенты с классами заявок - каждый класс своим потоком,
+// остальные - одним потоком с интервалами Arrival или lamb мс.
+func StartRequestGeneration(ctx context.Context, clients []*Client, stagingManager *StagingManager, retrievalManager *RetrievalManager, wg *sync.WaitGroup, lamb float64, statsManager *StatsManager, duration time.Duration, pauseTime time.Duration) {
 	go func() {
 		defer wg.Done()
-		timer := time.NewTimer(duration)
-		defer timer.Stop()
+		ctx, cancel := context.WithTimeout(ctx, duration)
+		defer cancel()
 
-		for {
-			select {
-			case <-timer.C:
-				// Таймер истек, завершаем горутину
-				return
-			default:
-				// Случайно выбираем клиента
-				client := clients[rand.Intn(len(clients))]
-
-				// Создаем заявку
-				request := client.SubmitRequest("TypeA")
-				// Записываем статистику о новой заявке
-				statsManager.RecordRequest()
-
-				// Добавляем заявку в буфер
-				if retrievalManager.CheckSpecialistAvailability() {
-					availableSpecialist := retrievalManager.SelectAvailableSpecialist()
-					if availableSpecialist != nil {
-						retrievalManager.SendRequestForProcessing(request, availableSpecialist, false)
-					} else {
-						fmt.Println("pizdec")
-					}
-				} else {
-					if !stagingManager.Buffer.AddRequest(request) {
-						// Если буфер полон, записываем отклоненную заявку
-						statsManager.RecordRejectedRequest()
-					}
+		begin := time.Now()
+		var generators sync.WaitGroup
+		for _, client := range clients {
+			generators.Add(1)
+			go func() {
+				defer generators.Done()
+				clientCtx, cancel, ok := clientContext(ctx, client, begin)
+				if !ok {
+					return
 				}
+				defer cancel()
+				generateClient(clientCtx, client, stagingManager, retrievalManager, lamb, statsManager)
+			}()
+		}
+		generators.Wait()
+	}()
+}
 
-				// Выводим содержимое буфера
-				stagingManager.Buffer.PrintBufferContent()
-				retrievalManager.PrintSpecialists()
+// clientContext waits until the client starts generating, counting from begin, and returns the context
+// that is done when the client stops. It reports false if ctx was done before the client started.
+func clientContext(ctx context.Context, client *Client, begin time.Time) (context.Context, context.CancelFunc, bool) {
+	if !sleepContext(ctx, time.Until(begin.Add(client.Start))) {
+		return nil, nil, false
+	}
+	if client.Stop > 0 {
+		clientCtx, cancel := context.WithDeadline(ctx, begin.Add(client.Stop))
+		return clientCtx, cancel, true
+	}
+	clientCtx, cancel := context.WithCancel(ctx)
+	return clientCtx, cancel, true
+}
 
-				// Ожидаем случайное время (интенсивность от 0 до 1)
-				time.Sleep(time.Duration(lamb * float64(time.Millisecond)))
-			}
+// generateClient запускает процессы генерации клиента и ждет их завершения после отмены ctx
+func generateClient(ctx context.Context, client *Client, stagingManager *StagingManager, retrievalManager *RetrievalManager, lamb float64, statsManager *StatsManager) {
+	var flows sync.WaitGroup
+	run := func(generate func()) {
+		flows.Add(1)
+		go func() {
+			defer flows.Done()
+			generate()
+		}()
+	}
+
+	switch {
+	case client.Outstanding > 0:
+		for i := 0; i < client.Outstanding; i++ {
+			run(func() {
+				generateClosed(ctx, client, stagingManager, retrievalManager, statsManager)
+			})
 		}
-	}()
+	case len(client.Classes) > 0:
+		for _, flow := range client.Classes {
+			run(func() {
+				generateFlow(ctx, flow.Arrival, func() *Request {
+					return client.SubmitClassRequest(flow.Class)
+				}, stagingManager, retrievalManager, statsManager)
+			})
+		}
+	default:
+		var arrival Distribution = Constant{Value: time.Duration(lamb * float64(time.Millisecond))}
+		if client.Arrival != nil {
+			arrival = client.Arrival
+		}
+		run(func() {
+			generateFlow(ctx, arrival, func() *Request {
+				return client.SubmitRequest("TypeA")
+			}, stagingManager, retrievalManager, statsManager)
+		})
+	}
+	flows.Wait()
 }
 
-// StartRequestProcessing запускает горутину для обработки заявок с ограничением по времени
-func StartRequestProcessing(retrievalManager *RetrievalManager, wg *sync.WaitGroup, statsManager *StatsManager, duration time.Duration, pauseTime time.Duration) {
+// generateFlow создает заявки submit с интервалами arrival, пока не отменен ctx. Первая заявка приходит
+// со случайной фазой, чтобы потоки разных клиентов с постоянными интервалами не шли в ногу.
+// Поток по профилю уже случаен, и его первая заявка приходит тогда, когда ее приводит профиль
+func generateFlow(ctx context.Context, arrival Distribution, submit func() *Request, stagingManager *StagingManager, retrievalManager *RetrievalManager, statsManager *StatsManager) {
+	wait := arrival.Sample()
+	if _, ok := arrival.(*ProfileArrival); !ok {
+		wait = time.Duration(rand.Float64() * float64(wait))
+	}
+	for ; sleepContext(ctx, wait); wait = arrival.Sample() {
+		PlaceRequest(submit(), stagingManager, retrievalManager, statsManager)
+	}
+}
+
+// generateClosed создает заявку клиента, ждет, пока она покинет систему, и после обдумывания создает следующую,
+// пока не отменен ctx. Класс каждой заявки клиента с классами выбирается случайно
+func generateClosed(ctx context.Context, client *Client, stagingManager *StagingManager, retrievalManager *RetrievalManager, statsManager *StatsManager) {
+	for ctx.Err() == nil {
+		var request *Request
+		if len(client.Classes) > 0 {
+			request = client.SubmitClassRequest(client.Classes[rand.Intn(len(client.Classes))].Class)
+		} else {
+			request = client.SubmitRequest("TypeA")
+		}
+		PlaceRequest(request, stagingManager, retrievalManager, statsManager)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-request.Done():
+		}
+		if !sleepContext(ctx, client.Think.Sample()) {
+			return
+		}
+	}
+}
+
+// StartRequestProcessing запускает горутину для обработки заявок с ограничением по времени или до отмены ctx
+// Диспетчер не опрашивает буфер, а просыпается, когда заявка попадает в буфер или специалист освобождается.
+// Статистику времени в буфере и обработки записывает retrievalManager.
+func StartRequestProcessing(ctx context.Context, retrievalManager *RetrievalManager, wg *sync.WaitGroup, duration time.Duration) {
 	go func() {
 		defer wg.Done()
-		timer := time.NewTimer(duration)
-		defer timer.Stop()
+		// Если duration не задана, обработка продолжается до отмены ctx
+		var timeout <-chan time.Time
+		if duration > 0 {
+			timer := time.NewTimer(duration)
+			defer timer.Stop()
+			timeout = timer.C
+		}
 
 		for {
+			// Отправляем заявки из буфера доступным специалистам, пока это возможно
+			retrievalManager.dispatchAll()
+
 			select {
-			case <-timer.C:
+			case <-ctx.Done():
+				// Эксперимент отменен, завершаем горутину
+				return
+			case <-timeout:
 				// Таймер истек, завершаем горутину
 				return
-			default:
-				// Выбираем следующую заявку из буфера
-				nextRequest := retrievalManager.SelectRequestClick()
-				if nextRequest == nil {
-					// Если буфер пуст, ждем
-					time.Sleep(pauseTime)
-					continue
-				}
-
-				// Выбираем доступного специалиста
-				availableSpecialist := retrievalManager.SelectAvailableSpecialist()
-				if availableSpecialist == nil {
-					// Если нет доступных специалистов, ждем
-					time.Sleep(pauseTime)
-					continue
-				}
-
-				// Записываем время, проведенное в буфере
-				statsManager.RecordBufferTime(time.Since(nextRequest.CreatedAt))
-
-				// Отправляем заявку на обработку
-				retrievalManager.SendRequestForProcessing(nextRequest, availableSpecialist, true)
-				statsManager.RecordProcessingTime(availableSpecialist.WorkTime)
-
-				// Записываем использование специалиста
-				statsManager.RecordSpecialistUsage(availableSpecialist.Id)
-				statsManager.RecordSpecialistWorkTime(availableSpecialist.Id, availableSpecialist.WorkTime)
-
-				// Ожидаем некоторое время перед следующей итерацией
-				time.Sleep(pauseTime)
+			case <-retrievalManager.Wakeup():
+				// Появилась заявка в буфере или освободился специалист
 			}
 		}
 	}()
 }
+
+// sleepContext pauses for d or until ctx is cancelled and reports whether the full pause passed.
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	if d <= 0 {
+		return ctx.Err() == nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
@@ -1,9 +1,12 @@
 package requestsystem
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"sort"
 	"sync"
+	"time"
 )
 
 // RetrievalManager manages the retrieval of requests and assignment to specialists.
@@ -11,64 +14,443 @@ type RetrievalManager struct {
 	Buffer                 *Buffer
 	Specialists            []*Specialist
 	CurrentRequest         *Request
-	CurrentSpecialistIndex int // Указатель на текущего специалиста в кольцевом буфере
-	wg                     sync.WaitGroup
-	mu                     sync.Mutex
+	CurrentSpecialistIndex int       // Указатель на текущего специалиста в кольцевом буфере
+	Timeline               *Timeline // Интервалы занятости специалистов, может быть nil
+	Events                 *EventBus
+	StatsManager           *StatsManager // Статистика обработанных заявок, может быть nil
+	Scheduler              Scheduler     // Выбор заявки из буфера, nil - самая старая заявка
+	Router                 *SkillRouter  // Маршрутизация по навыкам, nil - любой свободный специалист по кругу
+	Pools                  []*Pool       // Пулы специалистов, nil - специалисты не разделены на пулы
+	Topology               *Topology     // Разделение буфера, nil - заявки ждут в Buffer
+
+	// Прерывание обслуживания заявкой с большим приоритетом. Прерванная заявка передается в OnPreempt
+	Preemptive      bool
+	ResumePreempted bool // Прерванная заявка дообслуживается, а не обслуживается сначала
+	OnPreempt       func(request *Request)
+
+	wg sync.WaitGroup
+	mu sync.Mutex
+
+	// Контекст работы специалистов; отменяется CancelWork, чтобы прервать обработку
+	workCtx    context.Context
+	cancelWork context.CancelFunc
+	workOnce   sync.Once
+
+	// Сигнал диспетчеру: заявка попала в буфер или специалист освободился
+	wake     chan struct{}
+	wakeOnce sync.Once
+}
+
+// Wakeup returns the channel that receives a value when dispatching may become possible:
+// a request was placed in the buffer or a specialist became free.
+func (rm *RetrievalManager) Wakeup() <-chan struct{} {
+	return rm.wakeChannel()
+}
+
+// Notify wakes the dispatcher. It never blocks: pending notifications are merged into one.
+func (rm *RetrievalManager) Notify() {
+	select {
+	case rm.wakeChannel() <- struct{}{}:
+	default:
+	}
+}
+
+func (rm *RetrievalManager) wakeChannel() chan struct{} {
+	rm.wakeOnce.Do(func() {
+		rm.wake = make(chan struct{}, 1)
+	})
+	return rm.wake
+}
+
+// workContext returns the context passed to the specialists.
+func (rm *RetrievalManager) workContext() context.Context {
+	rm.workOnce.Do(func() {
+		rm.workCtx, rm.cancelWork = context.WithCancel(context.Background())
+	})
+	return rm.workCtx
+}
+
+// CancelWork interrupts the requests being processed and every request dispatched afterwards.
+func (rm *RetrievalManager) CancelWork() {
+	rm.workContext()
+	rm.cancelWork()
 }
 
 // SelectRequestClick selects a request from the buffer with priority by source number.
 func (rm *RetrievalManager) SelectRequestClick() *Request {
 	rm.mu.Lock()
 	defer rm.mu.Unlock()
+	return rm.takeRequest(nil)
+}
+
+// takeRequest takes the next request accepted by eligible: from the queues of the topology in the order
+// of its selection policy or from the shared buffer, then from the own buffers of the pools. rm.mu must be held.
+func (rm *RetrievalManager) takeRequest(eligible func(request *Request) bool) *Request {
+	if rm.Topology != nil {
+		for _, queue := range rm.Topology.Order() {
+			if request := rm.selectRequest(queue.Buffer, eligible); request != nil {
+				rm.Topology.Taken(queue)
+				if rm.StatsManager != nil {
+					rm.StatsManager.RecordQueueTake(queue.Name, time.Since(request.bufferedAt))
+				}
+				return request
+			}
+		}
+	} else if request := rm.selectRequest(rm.Buffer, eligible); request != nil {
+		return request
+	}
+	for _, pool := range rm.Pools {
+		if pool.Buffer == nil {
+			continue
+		}
+		if request := rm.selectRequest(pool.Buffer, eligible); request != nil {
+			return request
+		}
+	}
+	return nil
+}
 
+// selectRequest takes the next request accepted by eligible from the buffer. rm.mu must be held.
+func (rm *RetrievalManager) selectRequest(buffer *Buffer, eligible func(request *Request) bool) *Request {
+	if rm.Scheduler != nil {
+		return rm.Scheduler.Next(buffer, eligible)
+	}
 	// Get the next request from the buffer
-	request := rm.Buffer.GetNextRequest()
+	return FIFOScheduler{}.Next(buffer, eligible)
+}
+
+// SendRequestForProcessing sends a request to a specialist for processing and returns the processing time.
+func (rm *RetrievalManager) SendRequestForProcessing(request *Request, specialist *Specialist) {
+	rm.wg.Add(1) // Increment the WaitGroup counter
+
+	// Специалист занимается сразу, чтобы его не выбрали для другой заявки до запуска горутины
+	ctx, cancel := context.WithCancelCause(rm.workContext())
+	specialist.take(request, cancel)
+
+	go func() {
+		defer cancel(nil)
+		rm.Events.Publish(newRequestEvent(EventDispatched, request, specialist.Id))
+
+		start := time.Now()
+		workTime, next, err := specialist.process(ctx)
+		if next != nil {
+			// Специалист не освобождался и сразу обслуживает прервавшую заявку
+			rm.SendRequestForProcessing(next, specialist)
+		} else {
+			// Специалист свободен, буферизованная заявка может быть отправлена ему сразу
+			rm.Notify()
+		}
+
+		preempted := errors.Is(err, ErrPreempted)
+		if rm.StatsManager != nil {
+			rm.StatsManager.RecordProcessingTime(request, workTime)
+			rm.StatsManager.RecordSpecialistWorkTime(specialist.Id, workTime)
+			if preempted {
+				rm.StatsManager.RecordPreemption(request)
+			} else {
+				rm.StatsManager.RecordSpecialistUsage(specialist.Id)
+				rm.StatsManager.RecordCompletedRequest(request, err)
+			}
+		}
+		if preempted {
+			if !rm.ResumePreempted {
+				request.remaining = 0
+			}
+			rm.OnPreempt(request)
+		} else {
+			request.leave()
+		}
+		if rm.Timeline != nil {
+			rm.Timeline.Record(BusyInterval{
+				SpecialistID: specialist.Id,
+				RequestID:    request.ID,
+				ClientID:     request.Client.ID,
+				Start:        start,
+				End:          time.Now(),
+			})
+		}
+		rm.wg.Done()
+
+	}()
+}
+
+// DispatchRequest sends the request to an available specialist and reports whether one was found.
+// Selection and assignment happen under one lock, so a specialist never gets two requests at once.
+func (rm *RetrievalManager) DispatchRequest(request *Request) bool {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+
+	specialist := rm.selectSpecialistFor(request, 0)
+	if specialist == nil {
+		return false
+	}
+	rm.SendRequestForProcessing(request, specialist)
+	return true
+}
+
+// Preempt interrupts the processing of a request with a lower priority than request, the lowest one first,
+// and hands its specialist over to request. It reports whether request got a specialist.
+// It does nothing unless Preemptive and OnPreempt are set.
+func (rm *RetrievalManager) Preempt(request *Request) bool {
+	if !rm.Preemptive || rm.OnPreempt == nil {
+		return false
+	}
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+
+	type candidate struct {
+		specialist *Specialist
+		priority   int
+	}
+	var candidates []candidate
+	for _, specialist := range rm.Specialists {
+		if _, ok := specialist.Proficiency(request.Skill()); !ok {
+			continue
+		}
+		if request.pool != nil && specialist.Pool != request.pool.Name {
+			// Прерывается только обслуживание в пуле заявки
+			continue
+		}
+		if current := specialist.CurrentRequest(); current != nil && current.Priority() < request.Priority() {
+			candidates = append(candidates, candidate{specialist, current.Priority()})
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].priority < candidates[j].priority
+	})
+	for _, c := range candidates {
+		// Специалист мог закончить обработку или уже быть прерван другой заявкой
+		if c.specialist.Preempt(request) {
+			return true
+		}
+	}
+	return false
+}
+
+// DispatchFromBuffer sends the next buffered request to an available specialist.
+// It returns the dispatched request, or nil if there is no request or no free specialist.
+func (rm *RetrievalManager) DispatchFromBuffer() *Request {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+
+	if !rm.CheckSpecialistAvailability() {
+		return nil
+	}
+
+	var free []*Specialist
+	var eligible func(request *Request) bool
+	now := time.Now()
+	if rm.routed() {
+		// Из буферов берется только заявка, которую может обслужить свободный специалист
+		free = rm.freeSpecialists()
+		eligible = func(request *Request) bool {
+			specialist, _ := rm.match(request, free, now.Sub(request.bufferedAt))
+			return specialist != nil
+		}
+	}
+	request := rm.takeRequest(eligible)
 	if request == nil {
 		return nil
 	}
+	var specialist *Specialist
+	if rm.routed() {
+		specialist = rm.route(request, free, now.Sub(request.bufferedAt))
+	} else {
+		specialist = rm.selectAvailableSpecialist()
+	}
+
+	if rm.StatsManager != nil {
+		// Записываем время, проведенное в буфере
+		rm.StatsManager.RecordBufferTime(request, time.Since(request.bufferedAt))
+	}
+	rm.SendRequestForProcessing(request, specialist)
+	return request
+}
+
+// routed reports whether requests are matched to specialists by pools or skills
+// instead of going to any free specialist in turn.
+func (rm *RetrievalManager) routed() bool {
+	return rm.Router != nil || len(rm.Pools) > 0
+}
+
+// selectSpecialistFor selects an available specialist for the request that has waited for waited. rm.mu must be held.
+func (rm *RetrievalManager) selectSpecialistFor(request *Request, waited time.Duration) *Specialist {
+	if !rm.routed() {
+		return rm.selectAvailableSpecialist()
+	}
+	return rm.route(request, rm.freeSpecialists(), waited)
+}
 
-	// Filter out nil elements from the buffer
-	var filteredRequests []*Request
-	for _, r := range rm.Buffer.Requests {
-		if r != nil {
-			filteredRequests = append(filteredRequests, r)
+// route selects a specialist for the request among free ones with match, records overflows and moves
+// the round-robin pointer past the specialist, so equal specialists share the load. rm.mu must be held.
+func (rm *RetrievalManager) route(request *Request, free []*Specialist, waited time.Duration) *Specialist {
+	specialist, overflow := rm.match(request, free, waited)
+	if specialist == nil {
+		return nil
+	}
+	for i, s := range rm.Specialists {
+		if s == specialist {
+			rm.CurrentSpecialistIndex = (i + 1) % len(rm.Specialists)
+		}
+	}
+	if rm.StatsManager != nil {
+		if overflow {
+			rm.StatsManager.RecordOverflow(request)
+		}
+		if request.pool != nil && specialist.Pool != request.pool.Name {
+			rm.StatsManager.RecordPoolOverflow(request.pool.Name)
 		}
 	}
+	return specialist
+}
 
-	// Sort requests by source priority (assuming lower ID is higher priority)
-	sort.Slice(filteredRequests, func(i, j int) bool {
-		return filteredRequests[i].Client.ID < filteredRequests[j].Client.ID
-	})
+// match finds among free specialists the one that may serve the request now: a specialist of the pool
+// of the request or, following the overflow rules, of the pools it overflows to; within a pool the Router
+// chooses by skill. It also reports whether the specialist is less skilled than the primary ones.
+// match has no side effects. rm.mu must be held.
+func (rm *RetrievalManager) match(request *Request, free []*Specialist, waited time.Duration) (*Specialist, bool) {
+	if len(rm.Pools) == 0 {
+		return rm.matchSkill(request, free, waited)
+	}
 
-	return request
+	pool := rm.poolOf(request)
+	for hops := 0; pool != nil && hops < len(rm.Pools); hops++ {
+		var candidates []*Specialist
+		for _, specialist := range free {
+			if specialist.Pool == pool.Name {
+				candidates = append(candidates, specialist)
+			}
+		}
+		if specialist, overflow := rm.matchSkill(request, candidates, waited); specialist != nil {
+			return specialist, overflow
+		}
+		// Свободных подходящих специалистов в пуле нет
+		if waited < pool.OverflowAfter {
+			return nil, false
+		}
+		pool = pool.Overflow
+	}
+	return nil, false
 }
 
-// SendRequestForProcessing sends a request to a specialist for processing and returns the processing time.
-func (rm *RetrievalManager) SendRequestForProcessing(request *Request, specialist *Specialist, fromBuff bool) {
-	rm.wg.Add(1) // Increment the WaitGroup counter
+// matchSkill finds among free specialists the one that may serve the request by skill. rm.mu must be held.
+func (rm *RetrievalManager) matchSkill(request *Request, free []*Specialist, waited time.Duration) (*Specialist, bool) {
+	if rm.Router != nil {
+		return rm.Router.Route(request, free, waited)
+	}
+	if len(free) == 0 {
+		return nil, false
+	}
+	return free[0], false
+}
 
-	go func() {
-		//rm.wg.Done() // Decrement the WaitGroup counter when done
+// freeSpecialists returns the available specialists in round-robin order. rm.mu must be held.
+func (rm *RetrievalManager) freeSpecialists() []*Specialist {
+	var free []*Specialist
+	for i := 0; i < len(rm.Specialists); i++ {
+		specialist := rm.Specialists[(rm.CurrentSpecialistIndex+i)%len(rm.Specialists)]
+		if specialist.IsAvailable() {
+			free = append(free, specialist)
+		}
+	}
+	return free
+}
 
-		// Remove the request from the buffer only after the specialist starts processing it
+// AssignPool sets the pool of a new request: the pool of its class or the first pool.
+// It does nothing when the specialists are not divided into pools.
+func (rm *RetrievalManager) AssignPool(request *Request) {
+	if len(rm.Pools) == 0 || request.pool != nil {
+		return
+	}
+	request.pool = rm.Pools[0]
+	if request.Class != nil && request.Class.Pool != "" {
+		for _, pool := range rm.Pools {
+			if pool.Name == request.Class.Pool {
+				request.pool = pool
+			}
+		}
+	}
+}
 
-		specialist.TakeRequest(request)
+// poolOf returns the pool of the request, the first pool for a request without one.
+func (rm *RetrievalManager) poolOf(request *Request) *Pool {
+	if request.pool != nil {
+		return request.pool
+	}
+	return rm.Pools[0]
+}
 
-		specialist.ProcessRequest()
-		if fromBuff {
-			rm.Buffer.RemoveRequest(request)
+// buffers returns the shared buffer or the buffers of the topology and the own buffers of the pools.
+func (rm *RetrievalManager) buffers() []*Buffer {
+	buffers := []*Buffer{rm.Buffer}
+	if rm.Topology != nil {
+		buffers = rm.Topology.Buffers()
+	}
+	for _, pool := range rm.Pools {
+		if pool.Buffer != nil {
+			buffers = append(buffers, pool.Buffer)
 		}
+	}
+	return buffers
+}
 
-		rm.wg.Done()
+// BufferedRequests returns the number of requests in all buffers.
+func (rm *RetrievalManager) BufferedRequests() int {
+	n := 0
+	for _, buffer := range rm.buffers() {
+		n += buffer.Len()
+	}
+	return n
+}
 
-	}()
+// notifyBuffered wakes the dispatcher after the request was placed in a buffer. When the request
+// may overflow to less skilled specialists or to another pool after a wait, it wakes the dispatcher again then.
+func (rm *RetrievalManager) notifyBuffered(request *Request) {
+	rm.Notify()
+	if rm.Router != nil && rm.Router.Policy == RoutingOverflow && rm.Router.OverflowAfter > 0 {
+		time.AfterFunc(rm.Router.OverflowAfter, rm.Notify)
+	}
+	pool := request.pool
+	for hops := 0; pool != nil && pool.Overflow != nil && hops < len(rm.Pools); hops++ {
+		if pool.OverflowAfter > 0 {
+			time.AfterFunc(pool.OverflowAfter, rm.Notify)
+		}
+		pool = pool.Overflow
+	}
+}
+
+// Drain keeps dispatching buffered requests until the buffer is empty and all specialists are free.
+// It reports whether the system was drained before ctx was done.
+// The processing loop must be stopped, because Drain consumes the notifications of Wakeup.
+func (rm *RetrievalManager) Drain(ctx context.Context) bool {
+	for {
+		rm.dispatchAll()
+		if rm.BufferedRequests() == 0 && countBusy(rm.Specialists) == 0 {
+			return true
+		}
+		select {
+		case <-ctx.Done():
+			return false
+		case <-rm.Wakeup():
+		}
+	}
+}
+
+// dispatchAll sends buffered requests to specialists while both are available.
+func (rm *RetrievalManager) dispatchAll() {
+	for rm.DispatchFromBuffer() != nil {
+	}
 }
 
 // SelectAvailableSpecialist selects an available specialist in a round-robin fashion.
 func (rm *RetrievalManager) SelectAvailableSpecialist() *Specialist {
 	rm.mu.Lock()
 	defer rm.mu.Unlock()
+	return rm.selectAvailableSpecialist()
+}
 
+// selectAvailableSpecialist selects an available specialist. rm.mu must be held.
+func (rm *RetrievalManager) selectAvailableSpecialist() *Specialist {
 	// Проходим по кольцу специалистов, начиная с текущего указателя
 	for i := 0; i < len(rm.Specialists); i++ {
 		specialist := rm.Specialists[rm.CurrentSpecialistIndex]
@@ -108,8 +490,8 @@ func (rm *RetrievalManager) PrintSpecialists() {
 	fmt.Println("[ Specialists List: ]")
 	for i, specialist := range rm.Specialists {
 		status := "Available"
-		if !specialist.IsAvailable() {
-			status = fmt.Sprintf("Busy with Request ID: %d", specialist.CurrentRequest.ID)
+		if state := specialist.Snapshot(); !state.Available {
+			status = fmt.Sprintf("Busy with Request ID: %d", state.CurrentRequest.ID)
 		}
 		fmt.Printf("Specialist %d: %s || ", i+1, status)
 	}
@@ -0,0 +1,90 @@
+package requestsystem
+
+import (
+	"fmt"
+	"time"
+)
+
+// Политики маршрутизации по навыкам
+const (
+	RoutingBest     = "best"     // Свободный специалист с наибольшей квалификацией
+	RoutingOverflow = "overflow" // Основной специалист, а после ожидания OverflowAfter - менее квалифицированный
+)
+
+// SkillRouter chooses a specialist whose skills are compatible with the request.
+// A request without a skill and a specialist without skills are compatible with anything.
+type SkillRouter struct {
+	Policy        string
+	Primary       float64       // Квалификация, с которой специалист считается основным для навыка
+	OverflowAfter time.Duration // overflow: сколько заявка ждет основного специалиста, прежде чем уйти к менее квалифицированному
+}
+
+// Route returns the specialist among free ones that serves the request, and whether it is less skilled than Primary.
+// waited is how long the request has waited in the buffer. Among equal specialists the first one in free wins.
+// It returns nil if no free specialist may serve the request now.
+func (r *SkillRouter) Route(request *Request, free []*Specialist, waited time.Duration) (*Specialist, bool) {
+	skill := request.Skill()
+
+	var best *Specialist
+	bestProficiency := 0.0
+	for _, specialist := range free {
+		proficiency, ok := specialist.Proficiency(skill)
+		if !ok {
+			continue
+		}
+		if r.Policy == RoutingOverflow && proficiency >= r.Primary {
+			// Первый свободный основной специалист
+			return specialist, false
+		}
+		if proficiency > bestProficiency {
+			best, bestProficiency = specialist, proficiency
+		}
+	}
+	if best == nil {
+		return nil, false
+	}
+	if r.Policy == RoutingOverflow && waited < r.OverflowAfter {
+		// Основных специалистов нет, заявка еще ждет их
+		return nil, false
+	}
+	return best, bestProficiency < r.Primary
+}
+
+// SkillsConfig describes the skill matrix and the routing policy in the experiment config.
+type SkillsConfig struct {
+	Routing       string   `json:"routing"`                  // best, overflow
+	Primary       float64  `json:"primary,omitempty"`        // По умолчанию 1
+	OverflowAfter Duration `json:"overflow_after,omitempty"` // overflow
+
+	// ID специалиста -> навык -> квалификация, множитель скорости обслуживания.
+	// Специалист без навыков обслуживает любые заявки со скоростью 1
+	Specialists map[int]map[string]float64 `json:"specialists"`
+}
+
+// Router creates the router described by the config.
+func (sc SkillsConfig) Router() (*SkillRouter, error) {
+	switch sc.Routing {
+	case RoutingBest, RoutingOverflow:
+	default:
+		return nil, fmt.Errorf("unknown routing policy %q", sc.Routing)
+	}
+	if sc.Primary < 0 {
+		return nil, fmt.Errorf("primary must not be negative")
+	}
+	if sc.OverflowAfter < 0 {
+		return nil, fmt.Errorf("overflow_after must not be negative")
+	}
+	for id, skills := range sc.Specialists {
+		for skill, proficiency := range skills {
+			if proficiency <= 0 {
+				return nil, fmt.Errorf("specialist %d skill %q: proficiency must be positive", id, skill)
+			}
+		}
+	}
+
+	router := &SkillRouter{Policy: sc.Routing, Primary: sc.Primary, OverflowAfter: time.Duration(sc.OverflowAfter)}
+	if router.Primary == 0 {
+		router.Primary = 1
+	}
+	return router, nil
+}
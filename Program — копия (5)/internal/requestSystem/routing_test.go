@@ -0,0 +1,61 @@
+package requestsystem
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSkillRouterRoute(t *testing.T) {
+	// Специалисты 1 и 2 - основные для billing, 3 умеет billing хуже, 4 - без навыков, 5 - только sales
+	specialists := make([]*Specialist, 5)
+	for i := range specialists {
+		specialists[i] = NewSpecialist(i+1, 1, nil)
+	}
+	specialists[0].Skills = map[string]float64{"billing": 1}
+	specialists[1].Skills = map[string]float64{"billing": 1.5}
+	specialists[2].Skills = map[string]float64{"billing": 0.5}
+	specialists[4].Skills = map[string]float64{"sales": 1}
+
+	tests := []struct {
+		name      string
+		router    SkillRouter
+		skill     string
+		free      []int // Индексы свободных специалистов
+		waited    time.Duration
+		want      int // Индекс выбранного специалиста, -1 - никто
+		secondary bool
+	}{
+		{"best picks highest proficiency", SkillRouter{Policy: RoutingBest, Primary: 1}, "billing", []int{0, 1, 2}, 0, 1, false},
+		{"specialist without skills serves any skill", SkillRouter{Policy: RoutingBest, Primary: 1}, "billing", []int{2, 3}, 0, 3, false},
+		{"best below primary", SkillRouter{Policy: RoutingBest, Primary: 1}, "billing", []int{2}, 0, 2, true},
+		{"no compatible specialist", SkillRouter{Policy: RoutingBest, Primary: 1}, "billing", []int{4}, 0, -1, false},
+		{"no skill fits anyone", SkillRouter{Policy: RoutingBest, Primary: 1}, "", []int{4}, 0, 4, false},
+		{"overflow takes first primary", SkillRouter{Policy: RoutingOverflow, Primary: 1}, "billing", []int{2, 0, 1}, 0, 0, false},
+		{"overflow waits for primary", SkillRouter{Policy: RoutingOverflow, Primary: 1, OverflowAfter: time.Second}, "billing", []int{2}, time.Millisecond, -1, false},
+		{"overflow after waiting", SkillRouter{Policy: RoutingOverflow, Primary: 1, OverflowAfter: time.Second}, "billing", []int{2}, time.Second, 2, true},
+		{"nobody free", SkillRouter{Policy: RoutingBest, Primary: 1}, "billing", nil, 0, -1, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &Client{ID: "1"}
+			request := client.SubmitClassRequest(&RequestClass{Name: "Test", Skill: tt.skill})
+			free := make([]*Specialist, len(tt.free))
+			for i, j := range tt.free {
+				free[i] = specialists[j]
+			}
+
+			got, secondary := tt.router.Route(request, free, tt.waited)
+			var want *Specialist
+			if tt.want >= 0 {
+				want = specialists[tt.want]
+			}
+			if got != want || secondary != tt.secondary {
+				gotID := 0
+				if got != nil {
+					gotID = got.Id
+				}
+				t.Fatalf("Route() = specialist %d, %v; want specialist %d, %v", gotID, secondary, tt.want+1, tt.secondary)
+			}
+		})
+	}
+}
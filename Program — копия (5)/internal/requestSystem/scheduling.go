@@ -0,0 +1,173 @@
+package requestsystem
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+)
+
+// Scheduler chooses which buffered request goes to a free specialist.
+type Scheduler interface {
+	// Next removes the chosen request from the buffer and returns it, or nil if there is no request.
+	// Only requests accepted by eligible may be chosen, e.g. those a free specialist is able to serve;
+	// nil eligible accepts any request.
+	Next(buffer *Buffer, eligible func(request *Request) bool) *Request
+}
+
+// FIFOScheduler takes the oldest buffered request.
+type FIFOScheduler struct{}
+
+// Next takes the oldest request.
+func (FIFOScheduler) Next(buffer *Buffer, eligible func(request *Request) bool) *Request {
+	if eligible == nil {
+		return buffer.GetNextRequest()
+	}
+	return buffer.TakeBest(nil, eligible)
+}
+
+// PriorityScheduler takes the buffered request with the highest priority, the oldest one among equal priorities.
+// A request in service is never interrupted by it: preemption is done by the RetrievalManager.
+type PriorityScheduler struct{}
+
+// Next takes the request with the highest priority.
+func (PriorityScheduler) Next(buffer *Buffer, eligible func(request *Request) bool) *Request {
+	return buffer.TakeHighestPriority(eligible)
+}
+
+// SourcePriorityScheduler takes a request of the client with the smallest number, the oldest one of that client.
+type SourcePriorityScheduler struct{}
+
+// Next takes the request of the client with the smallest number.
+func (SourcePriorityScheduler) Next(buffer *Buffer, eligible func(request *Request) bool) *Request {
+	return buffer.TakeByClient(lessClientID, eligible)
+}
+
+// lessClientID compares client IDs as numbers when both are numbers.
+func lessClientID(a, b string) bool {
+	x, errA := strconv.Atoi(a)
+	y, errB := strconv.Atoi(b)
+	if errA == nil && errB == nil {
+		return x < y
+	}
+	return a < b
+}
+
+// FairScheduler shares the specialists between clients in proportion to their weights with start-time fair queuing:
+// every client has a virtual start tag, the request of the client with the smallest tag is taken, and the tag grows
+// by 1/weight per taken request. A client that had no requests waiting starts from the current virtual time,
+// so it does not make up for the time it was idle: its effective tag is never below the virtual time, and as the
+// virtual time only grows, the tag is raised when the client is chosen instead of on every call. It is safe for concurrent use.
+type FairScheduler struct {
+	Weights map[string]float64 // Вес клиента по ID, по умолчанию 1
+
+	mu      sync.Mutex
+	tags    map[string]float64 // Виртуальное время начала следующей заявки клиента
+	virtual float64            // Тег последней взятой заявки
+}
+
+// Next takes the oldest request of the client with the smallest virtual start tag.
+func (s *FairScheduler) Next(buffer *Buffer, eligible func(request *Request) bool) *Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.tags == nil {
+		s.tags = make(map[string]float64)
+	}
+
+	request := buffer.TakeByClient(func(a, b string) bool {
+		return s.tag(a) < s.tag(b)
+	}, eligible)
+	if request == nil {
+		return nil
+	}
+	id := request.Client.ID
+	s.virtual = s.tag(id)
+	s.tags[id] = s.virtual + 1/s.weight(id)
+	return request
+}
+
+// tag returns the virtual start tag of the next request of the client. s.mu must be held.
+func (s *FairScheduler) tag(clientID string) float64 {
+	// Клиенты, вернувшиеся после простоя, начинают с текущего виртуального времени
+	return max(s.tags[clientID], s.virtual)
+}
+
+// weight returns the weight of the client.
+func (s *FairScheduler) weight(clientID string) float64 {
+	if w, ok := s.Weights[clientID]; ok {
+		return w
+	}
+	return 1
+}
+
+// schedulerWeights returns the client weights of a fair scheduler, nil for other schedulers.
+func schedulerWeights(scheduler Scheduler) map[string]float64 {
+	if fs, ok := scheduler.(*FairScheduler); ok {
+		return fs.Weights
+	}
+	return nil
+}
+
+// Дисциплины обслуживания в конфигурации
+const (
+	DisciplineFIFO     = "fifo"
+	DisciplinePriority = "priority"
+	DisciplineSource   = "source" // Приоритет по номеру клиента
+	DisciplineWFQ      = "wfq"    // Справедливое разделение между клиентами по весам
+)
+
+// Что происходит с прерванной заявкой, когда она снова попадает к специалисту
+const (
+	PreemptedResume  = "resume"  // Обслуживание продолжается с места прерывания
+	PreemptedRestart = "restart" // Обслуживание начинается сначала
+)
+
+// SchedulingConfig describes the service discipline in the experiment config.
+type SchedulingConfig struct {
+	Discipline string `json:"discipline"`          // fifo, priority
+	Preemptive bool   `json:"preemptive"`          // Заявка с большим приоритетом прерывает обслуживание заявки с меньшим
+	Preempted  string `json:"preempted,omitempty"` // resume, restart; по умолчанию resume
+	Eviction   string `json:"eviction,omitempty"`  // Вытеснение из полного буфера: newest, lowest_priority
+
+	Weights map[string]float64 `json:"weights,omitempty"` // wfq: вес клиента по ID, по умолчанию 1
+}
+
+// Scheduler creates the scheduler of the discipline described by the config.
+func (sc SchedulingConfig) Scheduler() (Scheduler, error) {
+	var scheduler Scheduler
+	switch sc.Discipline {
+	case "", DisciplineFIFO:
+		scheduler = FIFOScheduler{}
+	case DisciplinePriority:
+		scheduler = PriorityScheduler{}
+	case DisciplineSource:
+		scheduler = SourcePriorityScheduler{}
+	case DisciplineWFQ:
+		for id, w := range sc.Weights {
+			if w <= 0 {
+				return nil, fmt.Errorf("client %s: weight must be positive", id)
+			}
+		}
+		scheduler = &FairScheduler{Weights: sc.Weights}
+	default:
+		return nil, fmt.Errorf("unknown discipline %q", sc.Discipline)
+	}
+
+	if len(sc.Weights) > 0 && sc.Discipline != DisciplineWFQ {
+		return nil, fmt.Errorf("weights require the %q discipline", DisciplineWFQ)
+	}
+	if sc.Preemptive && sc.Discipline != DisciplinePriority {
+		return nil, fmt.Errorf("preemption requires the %q discipline", DisciplinePriority)
+	}
+	switch sc.Preempted {
+	case "", PreemptedResume, PreemptedRestart:
+	default:
+		return nil, fmt.Errorf("unknown preempted policy %q", sc.Preempted)
+	}
+	switch sc.Eviction {
+	case "", EvictNewest, EvictLowestPriority:
+	default:
+		return nil, fmt.Errorf("unknown eviction policy %q", sc.Eviction)
+	}
+	return scheduler, nil
+}
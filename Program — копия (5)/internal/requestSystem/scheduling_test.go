@@ -0,0 +1,80 @@
+package requestsystem
+
+import (
+	"strings"
+	"testing"
+)
+
+// takeAll takes the requests from the buffer with the scheduler and returns the IDs of their clients.
+func takeAll(scheduler Scheduler, b *Buffer) string {
+	var ids []string
+	for request := scheduler.Next(b, nil); request != nil; request = scheduler.Next(b, nil) {
+		ids = append(ids, request.Client.ID)
+	}
+	return strings.Join(ids, " ")
+}
+
+func TestSourcePrioritySchedulerNext(t *testing.T) {
+	tests := []struct {
+		name    string
+		clients []string
+		want    string
+	}{
+		{"numeric order", []string{"10", "2", "1", "2"}, "1 2 2 10"},
+		{"names", []string{"b", "a", "b"}, "a b b"},
+		{"single client", []string{"1", "1", "1"}, "1 1 1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewBuffer(len(tt.clients))
+			for _, id := range tt.clients {
+				b.PushRequest(bufferRequest(id, 0))
+			}
+			if got := takeAll(SourcePriorityScheduler{}, b); got != tt.want {
+				t.Fatalf("took %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFairSchedulerNext(t *testing.T) {
+	tests := []struct {
+		name    string
+		weights map[string]float64
+		clients []string
+		want    string
+	}{
+		{"equal weights alternate", nil, []string{"a", "a", "a", "b", "b", "b"}, "a b a b a b"},
+		{"weight 2 takes twice as often", map[string]float64{"a": 2}, []string{"b", "b", "a", "a", "a", "a"}, "b a a b a a"},
+		{"single client", nil, []string{"a", "a"}, "a a"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewBuffer(len(tt.clients))
+			for _, id := range tt.clients {
+				b.PushRequest(bufferRequest(id, 0))
+			}
+			if got := takeAll(&FairScheduler{Weights: tt.weights}, b); got != tt.want {
+				t.Fatalf("took %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFairSchedulerIdleClient(t *testing.T) {
+	s := &FairScheduler{}
+	b := NewBuffer(8)
+	for range 4 {
+		b.PushRequest(bufferRequest("a", 0))
+	}
+	takeAll(s, b)
+
+	// Клиент b простаивал и начинает с текущего виртуального времени, а не забирает все заявки подряд
+	for range 2 {
+		b.PushRequest(bufferRequest("a", 0))
+		b.PushRequest(bufferRequest("b", 0))
+	}
+	if got, want := takeAll(s, b), "b a b a"; got != want {
+		t.Fatalf("took %q, want %q", got, want)
+	}
+}
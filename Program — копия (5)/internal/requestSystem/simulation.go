@@ -0,0 +1,359 @@
+package requestsystem
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Simulation wires together all components of a single experiment.
+type Simulation struct {
+	Config           Config
+	Clients          []*Client
+	Buffer           *Buffer
+	Specialists      []*Specialist
+	CreatedAtTimes   []time.Time
+	StagingManager   *StagingManager
+	RetrievalManager *RetrievalManager
+	StatsManager     *StatsManager
+	ReportManager    *ReportManager
+	Events           *EventBus
+	Pools            []*Pool     // Пулы специалистов, nil - специалисты не разделены на пулы
+	Topology         *Topology   // Разделение буфера, nil - все заявки ждут в Buffer
+	Orbit            *Orbit      // Орбита повторных попыток, nil - отклоненные заявки теряются
+	Admission        *Admission  // Ограничение скорости клиентов, nil - заявки допускаются всегда
+	Console          io.Writer   // Журнал событий заявок; nil - события не печатаются
+	Logger           *log.Logger // Ошибки и предупреждения эксперимента; nil - печатаются в стандартный вывод
+}
+
+// statsEventInterval is how often a statistics snapshot is published to the event bus.
+const statsEventInterval = time.Second
+
+// NewSimulation creates clients, specialists, buffer and managers described by the config.
+func NewSimulation(cfg Config) (*Simulation, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	sim := &Simulation{Config: cfg, Events: NewEventBus()}
+
+	clients, err := cfg.NewClients()
+	if err != nil {
+		return nil, err
+	}
+	sim.Clients = clients
+
+	sim.Buffer = NewBuffer(cfg.BufferCap)
+	if cfg.Topology != nil {
+		topology, err := cfg.Topology.Topology(clients, classesOf(clients), sim.Buffer)
+		if err != nil {
+			return nil, err
+		}
+		sim.Topology = topology
+	}
+
+	if len(cfg.Pools) == 0 {
+		// Первая группа специалистов работает с коэффициентом LambEx, вторая - с LambEx2
+		for i := 1; i <= cfg.SpecsNum1+cfg.SpecsNum2; i++ {
+			if i <= cfg.SpecsNum1 {
+				sim.addSpecialist(cfg.LambEx, 1)
+			} else {
+				sim.addSpecialist(cfg.LambEx2, 2)
+			}
+		}
+	} else {
+		sim.addPools(cfg.Pools)
+	}
+
+	statsManager, err := NewStatsManager(cfg.StatsFile, len(sim.Specialists))
+	if err != nil {
+		return nil, err
+	}
+	sim.StatsManager = statsManager
+	sim.ReportManager = NewReportManager(statsManager)
+
+	sim.RetrievalManager = &RetrievalManager{
+		Buffer:       sim.Buffer,
+		Specialists:  sim.Specialists,
+		Pools:        sim.Pools,
+		Topology:     sim.Topology,
+		Timeline:     NewTimeline(sim.Specialists),
+		Events:       sim.Events,
+		StatsManager: statsManager,
+	}
+	sim.StagingManager = &StagingManager{Buffer: sim.Buffer, Topology: sim.Topology, Events: sim.Events, StatsManager: statsManager}
+
+	if cfg.Skills != nil {
+		router, err := cfg.Skills.Router()
+		if err != nil {
+			return nil, err
+		}
+		sim.RetrievalManager.Router = router
+	}
+
+	if sc := cfg.Scheduling; sc != nil {
+		scheduler, err := sc.Scheduler()
+		if err != nil {
+			return nil, err
+		}
+		for _, buffer := range sim.RetrievalManager.buffers() {
+			buffer.Eviction = sc.Eviction
+		}
+		sim.RetrievalManager.Scheduler = scheduler
+		sim.RetrievalManager.Preemptive = sc.Preemptive
+		sim.RetrievalManager.ResumePreempted = sc.Preempted != PreemptedRestart
+		sim.RetrievalManager.OnPreempt = func(request *Request) {
+			ReturnRequest(request, sim.StagingManager, sim.RetrievalManager, sim.StatsManager)
+		}
+	}
+
+	if cfg.Retrial != nil {
+		orbit, err := NewOrbit(*cfg.Retrial)
+		if err != nil {
+			return nil, err
+		}
+		orbit.StatsManager = statsManager
+		orbit.Events = sim.Events
+		orbit.Retry = func(request *Request) {
+			RetryRequest(request, sim.StagingManager, sim.RetrievalManager, sim.StatsManager)
+		}
+		sim.Orbit = orbit
+		sim.StagingManager.Orbit = orbit
+	}
+
+	if cfg.Admission != nil {
+		admission, err := cfg.Admission.Admission(clients)
+		if err != nil {
+			return nil, err
+		}
+		admission.StatsManager = statsManager
+		admission.Events = sim.Events
+		admission.Place = func(request *Request) {
+			AdmitRequest(request, sim.StagingManager, sim.RetrievalManager, sim.StatsManager)
+		}
+		sim.Admission = admission
+		sim.StagingManager.Admission = admission
+	}
+
+	return sim, nil
+}
+
+// addSpecialist creates the next specialist of the group with its skills.
+func (sim *Simulation) addSpecialist(lambda float64, group int) *Specialist {
+	specialist := NewSpecialist(len(sim.Specialists)+1, lambda, sim.Events)
+	specialist.Group = group
+	if sim.Config.Skills != nil {
+		specialist.Skills = sim.Config.Skills.Specialists[specialist.Id]
+	}
+	sim.Specialists = append(sim.Specialists, specialist)
+	sim.CreatedAtTimes = append(sim.CreatedAtTimes, specialist.CreatedAt)
+	return specialist
+}
+
+// addPools creates the pools, their specialists and buffers. The specialists of a pool form the group
+// with the number of the pool, starting from 1.
+func (sim *Simulation) addPools(configs []PoolConfig) {
+	byName := make(map[string]*Pool, len(configs))
+	for i, pc := range configs {
+		pool := &Pool{Name: pc.Name}
+		if pc.BufferCap > 0 {
+			pool.Buffer = NewBuffer(pc.BufferCap)
+		}
+		for j := 0; j < pc.Specialists; j++ {
+			specialist := sim.addSpecialist(pc.Lambda, i+1)
+			specialist.Pool = pc.Name
+			pool.Specialists = append(pool.Specialists, specialist)
+		}
+		sim.Pools = append(sim.Pools, pool)
+		byName[pc.Name] = pool
+	}
+	for i, pc := range configs {
+		if pc.Overflow != nil {
+			sim.Pools[i].Overflow = byName[pc.Overflow.To]
+			sim.Pools[i].OverflowAfter = time.Duration(pc.Overflow.After)
+		}
+	}
+}
+
+// Run starts generation and processing and blocks until both finish or ctx is cancelled.
+// After that no new requests are accepted; with Drain the remaining requests are processed
+// within DrainTimeout, then the requests still in progress are interrupted and statistics are flushed.
+func (sim *Simulation) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+
+	if sim.Console != nil {
+		// Печатаем события в отдельной горутине, чтобы вывод не замедлял генерацию и обработку
+		sub := sim.Events.Subscribe(EventFilter{}, consoleBufferSize)
+		consoleDone := make(chan struct{})
+		go func() {
+			defer close(consoleDone)
+			WriteEvents(sim.Console, sub)
+		}()
+		defer func() {
+			sim.Events.Unsubscribe(sub)
+			<-consoleDone
+		}()
+	}
+
+	// Окна статистики отсчитываются от начала генерации
+	sim.StatsManager.StartWindows(time.Duration(sim.Config.StatsWindow))
+
+	// Запускаем горутину для генерации заявок
+	wg.Add(1)
+	StartRequestGeneration(ctx, sim.Clients, sim.StagingManager, sim.RetrievalManager, &wg, sim.Config.Lamb, sim.StatsManager,
+		time.Duration(sim.Config.Duration1), time.Duration(sim.Config.PauseGen))
+
+	// Запускаем горутину для обработки заявок
+	wg.Add(1)
+	StartRequestProcessing(ctx, sim.RetrievalManager, &wg, time.Duration(sim.Config.Duration2))
+
+	// Логируем статистику, пока работают генератор и процессор
+	logCtx, stopLogging := context.WithCancel(context.Background())
+	loggerDone := make(chan struct{})
+	go func() {
+		defer close(loggerDone)
+		sim.logStatistics(logCtx)
+	}()
+
+	// Ожидаем завершения всех горутин
+	wg.Wait()
+	sim.shutdown()
+	stopLogging()
+	<-loggerDone
+
+	// Логируем статистику после завершения работы
+	sim.StatsManager.Flush(len(sim.Specialists), sim.CreatedAtTimes)
+}
+
+// shutdown optionally drains the system and interrupts the requests still being processed.
+// Requests left in the buffers are recorded as rejected.
+func (sim *Simulation) shutdown() {
+	// Отложенные лимитом заявки отклоняются, клиенты из орбиты больше не перезванивают
+	sim.Admission.Close()
+	for _, request := range sim.Orbit.Close() {
+		// Клиент не дозвонился до конца эксперимента: заявка потеряна
+		sim.StatsManager.RecordOrbitLoss(request, 0)
+		request.leave()
+	}
+
+	if sim.Config.Drain {
+		drainCtx, cancel := context.WithTimeout(context.Background(), time.Duration(sim.Config.DrainTimeout))
+		if !sim.RetrievalManager.Drain(drainCtx) {
+			sim.logf("Drain timeout exceeded, interrupting remaining requests")
+		}
+		cancel()
+	}
+	sim.RetrievalManager.CancelWork()
+	sim.RetrievalManager.WaitForAllRequests()
+
+	// Заявки, оставшиеся в буферах, не обработаны до конца эксперимента: они отклоняются, как в WorkerPool.Stop
+	for _, buffer := range sim.RetrievalManager.buffers() {
+		for request := buffer.GetNextRequest(); request != nil; request = buffer.GetNextRequest() {
+			sim.StatsManager.RecordRejectedRequest(request)
+			request.leave()
+		}
+	}
+}
+
+// logStatistics records statistics every 10 ms and publishes snapshots until ctx is cancelled.
+func (sim *Simulation) logStatistics(ctx context.Context) {
+	RunStatsLogger(ctx, sim.StatsManager, sim.RetrievalManager.BufferedRequests, sim.CreatedAtTimes, sim.Events)
+}
+
+// RunStatsLogger records statistics every 10 ms and publishes snapshots to events until ctx is cancelled.
+// occupancy returns the number of buffered requests. occupancy and events may be nil.
+func RunStatsLogger(ctx context.Context, statsManager *StatsManager, occupancy func() int, createdAtTimes []time.Time, events *EventBus) {
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+	statsTicker := time.NewTicker(statsEventInterval)
+	defer statsTicker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-statsTicker.C:
+			snapshot := statsManager.Snapshot()
+			events.Publish(Event{Type: EventStats, Time: snapshot.Timestamp, Stats: &snapshot})
+		case <-ticker.C:
+			statsManager.RecordWorkTime(10 * time.Millisecond)
+			if occupancy != nil {
+				statsManager.RecordBufferOccupancy(occupancy())
+			}
+			statsManager.LogStatistics(len(createdAtTimes), createdAtTimes)
+		}
+	}
+}
+
+// BusySpecialists returns the number of specialists currently processing a request.
+func (sim *Simulation) BusySpecialists() int {
+	return countBusy(sim.Specialists)
+}
+
+// countBusy returns the number of specialists that are not available.
+func countBusy(specialists []*Specialist) int {
+	busy := 0
+	for _, s := range specialists {
+		if !s.IsAvailable() {
+			busy++
+		}
+	}
+	return busy
+}
+
+// GenerateReports prints the text reports to ReportManager.Out and writes the HTML report and timelines into dir.
+func (sim *Simulation) GenerateReports(dir string) {
+	sim.ReportManager.GenerateSpecialistReport(sim.Specialists, sim.CreatedAtTimes)
+	sim.ReportManager.GenerateSystemReport()
+	sim.ReportManager.GenerateClientReport()
+	sim.ReportManager.GenerateFairnessReport(schedulerWeights(sim.RetrievalManager.Scheduler))
+	if sim.Orbit != nil {
+		sim.ReportManager.GenerateRetrialReport()
+	}
+	if sim.Admission != nil {
+		sim.ReportManager.GenerateAdmissionReport()
+	}
+	if sim.Config.Closed != nil {
+		sim.ReportManager.GenerateClosedLoopReport(sim.Clients, time.Duration(sim.Config.Duration1))
+	}
+	if sim.Config.StatsWindow > 0 {
+		sim.ReportManager.GenerateWindowReport(len(sim.Specialists))
+	}
+	if len(sim.Config.Classes) > 0 {
+		sim.ReportManager.GenerateClassReport()
+	}
+	if sim.Config.Skills != nil {
+		sim.ReportManager.GenerateSkillReport(sim.Specialists)
+	}
+	if len(sim.Pools) > 0 {
+		sim.ReportManager.GeneratePoolReport(sim.Pools)
+	}
+	if sim.Topology != nil {
+		sim.ReportManager.GenerateQueueReport(sim.Topology)
+	}
+	if err := sim.ReportManager.GenerateHTMLReport(filepath.Join(dir, "report.html")); err != nil {
+		sim.logf("Error creating HTML report: %v", err)
+	}
+	if err := sim.ReportManager.GenerateTimelineReports(sim.RetrievalManager.Timeline,
+		filepath.Join(dir, "timeline.svg"), filepath.Join(dir, "trace.json")); err != nil {
+		sim.logf("Error creating timeline reports: %v", err)
+	}
+}
+
+// logf writes an error or a warning of the experiment to Logger or, without it, to the standard output.
+func (sim *Simulation) logf(format string, args ...interface{}) {
+	if sim.Logger != nil {
+		sim.Logger.Printf(format, args...)
+		return
+	}
+	fmt.Printf(format+"\n", args...)
+}
+
+// Close releases the files held by the simulation.
+func (sim *Simulation) Close() {
+	sim.StatsManager.Close()
+}
@@ -0,0 +1,96 @@
+package requestsystem
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// newTestSimulation creates a simulation with the config whose statistics go to a temporary directory.
+func newTestSimulation(t *testing.T, cfg Config) *Simulation {
+	t.Helper()
+	cfg.StatsFile = filepath.Join(t.TempDir(), "stats.log")
+	sim, err := NewSimulation(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(sim.Close)
+	return sim
+}
+
+// isDone reports whether the request has left the system.
+func isDone(request *Request) bool {
+	select {
+	case <-request.Done():
+		return true
+	default:
+		return false
+	}
+}
+
+func TestShutdownRejectsOrbit(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Retrial = &RetrialConfig{
+		Delay:      DistributionConfig{Kind: DistributionConstant, Mean: Duration(time.Hour)},
+		MaxRetries: 1,
+	}
+	sim := newTestSimulation(t, cfg)
+
+	request := sim.Clients[0].SubmitRequest("Test")
+	sim.StatsManager.RecordRequest(request)
+	request.Attempts++
+	if !sim.Orbit.Add(request) {
+		t.Fatal("orbit did not accept the request")
+	}
+
+	sim.shutdown()
+
+	if got := sim.Orbit.Len(); got != 0 {
+		t.Errorf("orbit holds %d requests after shutdown", got)
+	}
+	snapshot := sim.StatsManager.Snapshot()
+	if snapshot.RejectedRequests != 1 {
+		t.Errorf("RejectedRequests = %d, want 1", snapshot.RejectedRequests)
+	}
+	if snapshot.FirstAttemptRejections != 1 {
+		t.Errorf("FirstAttemptRejections = %d, want 1", snapshot.FirstAttemptRejections)
+	}
+	if snapshot.OrbitSize != 0 {
+		t.Errorf("OrbitSize = %d, want 0", snapshot.OrbitSize)
+	}
+	if !isDone(request) {
+		t.Error("request left in the orbit has not left the system")
+	}
+}
+
+func TestShutdownRejectsBuffered(t *testing.T) {
+	sim := newTestSimulation(t, DefaultConfig())
+
+	const patience = 20 * time.Millisecond
+	var requests []*Request
+	for i := 0; i < 2; i++ {
+		request := sim.Clients[i].SubmitRequest("Test")
+		sim.StatsManager.RecordRequest(request)
+		requests = append(requests, request)
+	}
+	sim.RetrievalManager.Buffer.AddRequest(requests[0])
+	sim.RetrievalManager.Buffer.PushRequestWithPatience(requests[1], patience, func(request *Request) {
+		t.Errorf("request %d abandoned the buffer after shutdown", request.ID)
+	})
+
+	sim.shutdown()
+
+	if got := sim.RetrievalManager.BufferedRequests(); got != 0 {
+		t.Errorf("buffers hold %d requests after shutdown", got)
+	}
+	if got := sim.StatsManager.Snapshot().RejectedRequests; got != 2 {
+		t.Errorf("RejectedRequests = %d, want 2", got)
+	}
+	for _, request := range requests {
+		if !isDone(request) {
+			t.Errorf("request %d left in the buffer has not left the system", request.ID)
+		}
+	}
+	// Таймер терпения остановлен вместе с удалением заявки из буфера
+	time.Sleep(2 * patience)
+}
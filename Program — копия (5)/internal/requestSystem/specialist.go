@@ -1,63 +1,250 @@
 package requestsystem
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"math"
 	"sync"
 	"time"
 )
 
-var outputMutex sync.Mutex // Мьютекс для синхронизации вывода
+// ErrPreempted is the error of a request whose processing was interrupted by a request with a higher priority.
+var ErrPreempted = errors.New("preempted by a request with a higher priority")
+
+// Handler performs the actual work for a request in the worker-pool mode.
+type Handler func(ctx context.Context, request *Request) error
 
 // Specialist represents a specialist that can process requests.
+// Exported fields are set when the specialist is created and are not changed afterwards.
+// The state of the specialist is guarded by mu and is read with the accessors.
 type Specialist struct {
-	CurrentRequest         *Request
+	Lambda    float64
+	Id        int
+	Pool      string // Имя пула специалиста, "" - специалисты не разделены на пулы
+	Group     int    // Группа специалистов (1, 2), задает время обслуживания классов заявок
+	CreatedAt time.Time
+	Events    *EventBus
+	Handler   Handler            // Обработчик заявок; если nil, обработка имитируется задержкой
+	Timeout   time.Duration      // Ограничение времени работы обработчика, 0 - без ограничения
+	Skills    map[string]float64 // Навык -> квалификация, множитель скорости обслуживания; nil - обслуживает любые заявки
+
+	mu                     sync.Mutex
+	currentRequest         *Request
+	available              bool
+	workTime               time.Duration           // Время обработки последней заявки
+	processedRequestsCount int                     // Количество отработанных заявок
+	cancel                 context.CancelCauseFunc // Прерывает обработку текущей заявки, nil - прервать нельзя
+	preemptor              *Request                // Заявка, прервавшая текущую; специалист перейдет к ней
+}
+
+// SpecialistSnapshot is a copy of the state of a specialist at a moment of time.
+type SpecialistSnapshot struct {
+	Id                     int
+	Lambda                 float64
 	Available              bool
+	CurrentRequest         *Request
 	WorkTime               time.Duration
-	Lambda                 float64
-	ProcessedRequestsCount int // Количество отработанных заявок
-	Id                     int
-	CreatedAt              time.Time
-	mu                     sync.Mutex
+	ProcessedRequestsCount int
+}
+
+// NewSpecialist creates an available specialist.
+func NewSpecialist(id int, lambda float64, events *EventBus) *Specialist {
+	return &Specialist{
+		Id:        id,
+		Lambda:    lambda,
+		CreatedAt: time.Now(),
+		Events:    events,
+		available: true,
+	}
+}
+
+// Proficiency returns the proficiency of the specialist in the skill and whether the specialist has it.
+// Every specialist can serve requests without a skill, and a specialist without skills can serve any request, both with proficiency 1.
+func (s *Specialist) Proficiency(skill string) (float64, bool) {
+	if skill == "" || s.Skills == nil {
+		return 1, true
+	}
+	proficiency, ok := s.Skills[skill]
+	return proficiency, ok
 }
 
 // TakeRequest assigns a request to the specialist.
 func (s *Specialist) TakeRequest(request *Request) {
-	// s.mu.Lock()
-	// defer s.mu.Unlock() // поробовать перевести в конец, мб пропадет хуйня
-	s.CurrentRequest = request
-	s.Available = false
-}
-
-// ProcessRequest processes the current request.
-func (s *Specialist) ProcessRequest() {
-	outputMutex.Lock()
-	fmt.Printf("Specialist %d Processing request %d\n", s.Id, s.CurrentRequest.ID)
-	outputMutex.Unlock()
-	s.CurrentRequest.UpdateStatus("Processing")
-
-	// Simulate exponential distribution for processing time
-	processingTime := time.Duration(10 * math.Exp(s.Lambda*float64(s.ProcessedRequestsCount)) * float64(time.Millisecond))
-	s.WorkTime = time.Duration(float64(processingTime) * 2.7)
-	time.Sleep(processingTime)
-
-	outputMutex.Lock()
-	if s.CurrentRequest != nil {
-		fmt.Printf("Request %d completed by spec %d\n", s.CurrentRequest.ID, s.Id)
-		s.CurrentRequest.UpdateStatus("Completed")
-		s.CurrentRequest = nil
+	s.take(request, nil)
+}
+
+// take assigns a request whose processing is interrupted by cancel to the specialist.
+func (s *Specialist) take(request *Request, cancel context.CancelCauseFunc) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.currentRequest = request
+	s.available = false
+	s.cancel = cancel
+}
+
+// Preempt interrupts the processing of the current request in favour of request
+// and reports whether it did. After the interrupted processing returns, the specialist
+// stays busy and takes request next.
+func (s *Specialist) Preempt(request *Request) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.currentRequest == nil || s.cancel == nil || s.preemptor != nil {
+		return false
+	}
+	s.preemptor = request
+	s.cancel(ErrPreempted)
+	return true
+}
+
+// ProcessRequest processes the current request and returns the time spent and the error of the handler.
+// Cancelling ctx interrupts the processing.
+// Until ProcessRequest returns, the request belongs to the goroutine that runs it.
+func (s *Specialist) ProcessRequest(ctx context.Context) (time.Duration, error) {
+	workTime, _, err := s.process(ctx)
+	return workTime, err
+}
+
+// process processes the current request like ProcessRequest and also returns the request
+// that preempted it, which is already assigned to the specialist, or nil.
+// A preempted simulated request keeps the rest of its service time to be resumed.
+func (s *Specialist) process(ctx context.Context) (time.Duration, *Request, error) {
+	s.mu.Lock()
+	request := s.currentRequest
+	processed := s.processedRequestsCount
+	s.mu.Unlock()
+	if request == nil {
+		return 0, nil, fmt.Errorf("specialist %d has no request", s.Id)
+	}
+
+	request.UpdateStatus("Processing")
+
+	// Квалифицированный специалист обслуживает заявку быстрее
+	proficiency, ok := s.Proficiency(request.Skill())
+	if !ok {
+		proficiency = 1
+	}
+
+	var workTime time.Duration
+	var err error
+	if s.Handler != nil {
+		workTime, err = s.runHandler(ctx, request)
+	} else if service := request.Class.ServiceTime(s.Group); service != nil {
+		// Время обслуживания задано классом заявки для группы специалиста
+		workTime, err = serve(ctx, request, time.Duration(float64(service.Sample())/proficiency))
+	} else {
+		// Simulate exponential distribution for processing time
+		processingTime := time.Duration(10 * math.Exp(s.Lambda*float64(processed)) / proficiency * float64(time.Millisecond))
+		processingTime, err = serve(ctx, request, processingTime)
+		workTime = time.Duration(float64(processingTime) * 2.7)
+	}
+	if err != nil && errors.Is(context.Cause(ctx), ErrPreempted) {
+		err = ErrPreempted
+	}
+
+	event := newRequestEvent(EventCompleted, request, s.Id)
+	if errors.Is(err, ErrPreempted) {
+		request.UpdateStatus("Preempted")
+		event.Type = EventPreempted
+	} else if errors.Is(err, context.Canceled) {
+		request.Err = err
+		request.UpdateStatus("Interrupted")
+		event.Error = err.Error()
+	} else if err != nil {
+		request.Err = err
+		request.UpdateStatus("Failed")
+		event.Error = err.Error()
+	} else {
+		request.UpdateStatus("Completed")
+	}
+	s.Events.Publish(event)
+
+	s.mu.Lock()
+	s.workTime = workTime
+	next := s.preemptor
+	if next != nil {
+		// Специалист сразу переходит к прервавшей заявке, не освобождаясь
+		s.currentRequest = next
 	} else {
-		fmt.Println("Request-huinya")
+		s.currentRequest = nil
+		s.available = true
+	}
+	s.preemptor = nil
+	s.cancel = nil
+	if !errors.Is(err, ErrPreempted) {
+		s.processedRequestsCount++ // Увеличиваем счетчик обработанных заявок
+	}
+	s.mu.Unlock()
+
+	return workTime, next, err
+}
+
+// serve simulates the service of the request for serviceTime, or for the rest of the time
+// left when it was preempted, and returns the time spent.
+func serve(ctx context.Context, request *Request, serviceTime time.Duration) (time.Duration, error) {
+	if request.remaining > 0 {
+		serviceTime = request.remaining
+	}
+	request.remaining = 0
+
+	start := time.Now()
+	if sleepContext(ctx, serviceTime) {
+		return serviceTime, nil
+	}
+	spent := time.Since(start)
+	request.remaining = serviceTime - spent
+	return spent, context.Cause(ctx)
+}
+
+// runHandler runs the handler for the request with the specialist's timeout
+// and returns the real time it took as the work time.
+func (s *Specialist) runHandler(ctx context.Context, request *Request) (workTime time.Duration, err error) {
+	if s.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.Timeout)
+		defer cancel()
 	}
-	s.Available = true
-	s.ProcessedRequestsCount++ // Увеличиваем счетчик обработанных заявок
 
-	outputMutex.Unlock()
+	start := time.Now()
+	defer func() {
+		workTime = time.Since(start)
+		if r := recover(); r != nil {
+			err = fmt.Errorf("handler panic: %v", r)
+		}
+	}()
+
+	err = s.Handler(ctx, request)
+	if err == nil && ctx.Err() != nil {
+		// Обработчик не уложился в отведенное время, но не проверил контекст
+		err = ctx.Err()
+	}
+	return workTime, err // workTime задается в defer
 }
 
 // IsAvailable checks if the specialist is available.
 func (s *Specialist) IsAvailable() bool {
-	// s.mu.Lock()
-	// defer s.mu.Unlock()
-	return s.Available
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.available
+}
+
+// CurrentRequest returns the request being processed, or nil if the specialist is available.
+func (s *Specialist) CurrentRequest() *Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.currentRequest
+}
+
+// Snapshot returns a copy of the state of the specialist.
+func (s *Specialist) Snapshot() SpecialistSnapshot {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return SpecialistSnapshot{
+		Id:                     s.Id,
+		Lambda:                 s.Lambda,
+		Available:              s.available,
+		CurrentRequest:         s.currentRequest,
+		WorkTime:               s.workTime,
+		ProcessedRequestsCount: s.processedRequestsCount,
+	}
 }
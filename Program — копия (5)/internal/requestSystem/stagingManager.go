@@ -1,16 +1,25 @@
 package requestsystem
 
-import "fmt"
+import (
+	"fmt"
+	"time"
+)
 
 // StagingManager manages the staging of requests.
 type StagingManager struct {
 	Buffer         *Buffer
 	CurrentRequest *Request
+	Events         *EventBus
+	StatsManager   *StatsManager          // Статистика ушедших заявок, может быть nil
+	OnAbandon      func(request *Request) // Вызывается для заявки, клиент которой ушел из буфера
+	Orbit          *Orbit                 // Орбита повторных попыток для отклоненных заявок, может быть nil
+	Topology       *Topology              // Разделение буфера, nil - все заявки ждут в Buffer
+	Admission      *Admission             // Ограничение скорости клиентов перед размещением, может быть nil
 }
 
-// InitiatePlacement initiates the placement of a request in the buffer.
+// InitiatePlacement initiates the placement of a request in the system.
 func (sm *StagingManager) InitiatePlacement(request *Request) {
-	fmt.Println("Initiating placement of request")
+	sm.Events.Publish(newRequestEvent(EventArrival, request, 0))
 }
 
 // CheckIsBufferFull checks if the buffer is full.
@@ -18,12 +27,104 @@ func (sm *StagingManager) CheckIsBufferFull() bool {
 	return sm.Buffer.IsFull()
 }
 
-// AddRequestBuffer adds a request to the buffer.
-func (sm *StagingManager) AddRequestBuffer(request *Request) {
-	if sm.Buffer.AddRequest(request) {
-		fmt.Printf("Request %d added to buffer\n", request.ID)
-	} else {
-		fmt.Printf("Buffer is full, discarding the last request and add %d \n", request.ID)
+// AddRequestBuffer adds a request to the buffer and returns the request it displaced, if any.
+// The displaced request may be the request itself, if the buffer keeps requests with a higher priority.
+// If the client has a patience, the request leaves the buffer as abandoned when the patience runs out.
+func (sm *StagingManager) AddRequestBuffer(request *Request) *Request {
+	return sm.place(request, false)
+}
+
+// ReturnRequestBuffer puts a preempted request back at the head of the buffer. The result is the same as of AddRequestBuffer.
+func (sm *StagingManager) ReturnRequestBuffer(request *Request) *Request {
+	return sm.place(request, true)
+}
+
+// place puts the request into its buffer at the tail or, with front, at the head and records the queue it joined.
+func (sm *StagingManager) place(request *Request, front bool) *Request {
+	buffer, queue, spilled := sm.bufferFor(request)
+	push := buffer.PushRequestWithPatience
+	if front {
+		push = buffer.ReturnRequest
+	}
+	displaced := sm.bufferRequest(request, push)
+	if queue != nil && displaced != request && sm.StatsManager != nil {
+		partition := ""
+		if spilled {
+			partition = request.Client.ID
+		}
+		sm.StatsManager.RecordQueuePlacement(queue.Name, partition)
+	}
+	return displaced
+}
+
+// bufferFor returns the buffer where the request waits: the own buffer of its pool, its queue of the topology
+// or the shared buffer. It also returns the queue of the topology, if any, and whether the request
+// spilled over from its full partition to the shared region.
+func (sm *StagingManager) bufferFor(request *Request) (*Buffer, *Queue, bool) {
+	if request.pool != nil && request.pool.Buffer != nil {
+		return request.pool.Buffer, nil, false
+	}
+	if sm.Topology != nil {
+		queue, spilled := sm.Topology.Place(request)
+		return queue.Buffer, queue, spilled
+	}
+	return sm.Buffer, nil, false
+}
+
+// bufferRequest places the request into the buffer with push and publishes the events.
+func (sm *StagingManager) bufferRequest(request *Request, push func(*Request, time.Duration, func(*Request)) *Request) *Request {
+	var patience time.Duration
+	if request.Client.Patience != nil {
+		patience = request.Client.Patience.Sample()
+	}
+	displaced := push(request, patience, sm.abandon)
+	if displaced != nil {
+		sm.Events.Publish(newRequestEvent(EventDisplaced, displaced, 0))
+	}
+	if displaced != request {
+		sm.Events.Publish(newRequestEvent(EventBuffered, request, 0))
+	}
+	return displaced
+}
+
+// Balks reports whether the client of the request refuses to join the buffer it sees.
+// specialists is the number of specialists used to estimate the expected wait.
+// A balked request is recorded and is not placed anywhere.
+func (sm *StagingManager) Balks(request *Request, specialists int) bool {
+	if request.Client.Balking == nil {
+		return false
+	}
+
+	buffer, _, _ := sm.bufferFor(request)
+	state := QueueState{QueueLength: buffer.Len(), Capacity: buffer.Capacity}
+	if sm.StatsManager != nil && specialists > 0 {
+		// Заявка будет обработана после всех заявок очереди
+		avgProcessingTime := sm.StatsManager.CalculateAverageProcessingTime()
+		state.ExpectedWait = time.Duration(avgProcessingTime * float64(time.Millisecond) * float64(state.QueueLength+1) / float64(specialists))
+	}
+	if !request.Client.Balking.Balk(state) {
+		return false
+	}
+
+	request.UpdateStatus("Balked")
+	request.leave()
+	if sm.StatsManager != nil {
+		sm.StatsManager.RecordBalkedRequest(request)
+	}
+	sm.Events.Publish(newRequestEvent(EventBalked, request, 0))
+	return true
+}
+
+// abandon records the request whose client ran out of patience and left the buffer.
+func (sm *StagingManager) abandon(request *Request) {
+	request.UpdateStatus("Abandoned")
+	request.leave()
+	if sm.StatsManager != nil {
+		sm.StatsManager.RecordAbandonedRequest(request)
+	}
+	sm.Events.Publish(newRequestEvent(EventAbandoned, request, 0))
+	if sm.OnAbandon != nil {
+		sm.OnAbandon(request)
 	}
 }
 
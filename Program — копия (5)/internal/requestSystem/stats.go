@@ -1,13 +1,18 @@
 package requestsystem
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"math/rand"
 	"os"
 	"sync"
 	"time"
 )
 
 // StatsManager manages the collection and logging of statistics.
+// All fields are guarded by mu and change while the system runs: read them with Snapshot,
+// or directly only after the run has finished.
 type StatsManager struct {
 	TotalRequests       int
 	RejectedRequests    int
@@ -17,9 +22,279 @@ type StatsManager struct {
 	mu                  sync.Mutex
 	File                *os.File
 	LastLogTime         time.Time
-	logChannel          chan string           // Буферизованный канал для записи логов
+	logChannel          chan string    // Буферизованный канал для записи логов
+	writerDone          chan struct{}  // Закрывается, когда logWriter записал все логи
+	sending             sync.WaitGroup // Строки лога, которые отправляются в logChannel вне sm.mu
+	closed              bool
 	TotalSystemTime     time.Duration         // Общее время работы системы
 	SpecialistWorkTime  map[int]time.Duration // Время работы каждого специалиста
+	Samples             []StatsSample         // Прореженная история значений, записанных LogStatistics, не больше sampleHistorySize точек
+	samplesSeen         int                   // Сколько точек прошло через историю
+	sampleStride        int                   // В истории остается каждая sampleStride-я точка
+	latestSample        *StatsSample          // Последняя точка, если она не попала в Samples
+	WaitTimes           []time.Duration       // Равномерная выборка времени ожидания в буфере, не больше waitSampleSize значений
+	waitsSeen           int                   // Сколько значений времени ожидания прошло через выборку
+	bufferOccupancy     int                   // Последнее известное заполнение буфера
+	ClientStats         map[string]*ClientStats
+	ClassStats          map[string]*ClassStats // По имени класса или типу заявки
+	SkillStats          map[string]*SkillStats // По навыку, нужному заявке; заявки без навыка не учитываются
+	CompletedRequests   int                    // Заявки, обработка которых завершилась
+	FailedRequests      int                    // Заявки, обработчик которых вернул ошибку
+	TimedOutRequests    int                    // Заявки, обработчик которых не уложился во время
+	InterruptedRequests int                    // Заявки, обработка которых прервана при остановке системы
+	AbandonedRequests   int                    // Заявки, клиенты которых не дождались обработки в буфере
+	BalkedRequests      int                    // Заявки, клиенты которых отказались вставать в очередь
+	Preemptions         int                    // Прерывания обслуживания заявками с большим приоритетом
+	ThrottledRequests   int                    // Заявки, отклоненные лимитом клиента до попадания в систему
+	DelayedRequests     int                    // Заявки, ждавшие допуска лимитом клиента
+	AdmissionDelay      time.Duration          // Суммарное ожидание допуска
+	PoolOverflows       map[string]int         // Пул -> заявки пула, отправленные специалистам других пулов
+	QueueStats          map[string]*QueueStats // Буфер топологии -> его статистика
+
+	// Статистика по окнам времени с начала работы, чтобы были видны пики нагрузки
+	WindowSize   time.Duration  // Длительность окна, 0 - статистика не делится на окна
+	Windows      []*WindowStats // По порядку начала
+	windowsStart time.Time
+	windowsEnd   time.Duration // Смещение последнего записанного момента
+
+	// Орбита повторных попыток. RejectedRequests считает заявки, отклоненные окончательно
+	FirstAttemptRejections int         // Заявки, отклоненные при первой попытке
+	RetryAttempts          int         // Повторные попытки из орбиты
+	Attempts               map[int]int // Число попыток -> количество заявок, покинувших систему после стольких попыток
+	orbitSize              int         // Последнее известное число заявок в орбите
+}
+
+// ClientStats holds the counters of a single client.
+type ClientStats struct {
+	Requests  int `json:"requests"`
+	Rejected  int `json:"rejected"`
+	Completed int `json:"completed"`
+	Failed    int `json:"failed"`
+	Abandoned int `json:"abandoned"`
+	Balked    int `json:"balked"`
+	Throttled int `json:"throttled"`
+
+	Delayed        int           `json:"delayed"`         // Заявки, ждавшие допуска лимитом клиента
+	AdmissionDelay time.Duration `json:"admission_delay"` // Суммарное ожидание допуска
+
+	ResponseTime time.Duration `json:"response_time"` // От создания до завершения обработки обработанных заявок
+
+	Waited   int           `json:"waited"`    // Заявки, взятые из буфера на обработку
+	WaitTime time.Duration `json:"wait_time"` // Время ожидания этих заявок в буфере
+}
+
+// share returns the share of n among the requests of the client.
+func (cs ClientStats) share(n int) float64 {
+	if cs.Requests == 0 {
+		return 0.0
+	}
+	return float64(n) / float64(cs.Requests)
+}
+
+// AverageWaitTime returns the average time a request of the client waited in the buffer in ms.
+func (cs ClientStats) AverageWaitTime() float64 {
+	if cs.Waited == 0 {
+		return 0.0
+	}
+	return float64(cs.WaitTime.Nanoseconds()) / float64(cs.Waited) / 1e6
+}
+
+// AverageResponseTime returns the average time from creation to the end of processing of the requests of the client in ms.
+func (cs ClientStats) AverageResponseTime() float64 {
+	if cs.Completed == 0 {
+		return 0.0
+	}
+	return float64(cs.ResponseTime.Nanoseconds()) / float64(cs.Completed) / 1e6
+}
+
+// AverageAdmissionDelay returns the average time a delayed request of the client waited to be let in, in ms.
+func (cs ClientStats) AverageAdmissionDelay() float64 {
+	if cs.Delayed == 0 {
+		return 0.0
+	}
+	return float64(cs.AdmissionDelay.Nanoseconds()) / float64(cs.Delayed) / 1e6
+}
+
+// JainIndex returns Jain's fairness index (sum x)^2 / (n * sum x^2) of the values: 1 when all values are equal,
+// 1/n when a single value takes everything. It returns 1 for no values or only zeros.
+func JainIndex(values []float64) float64 {
+	sum, squares := 0.0, 0.0
+	for _, x := range values {
+		sum += x
+		squares += x * x
+	}
+	if squares == 0 {
+		return 1
+	}
+	return sum * sum / (float64(len(values)) * squares)
+}
+
+// Fairness returns Jain's index over the throughput of the clients divided by their weights
+// and over the average wait times of the clients whose requests were taken from the buffer.
+// A client without a weight has weight 1.
+func (s StatsSnapshot) Fairness(weights map[string]float64) (throughput, wait float64) {
+	var throughputs, waits []float64
+	for id, cs := range s.ClientStats {
+		weight := 1.0
+		if w, ok := weights[id]; ok {
+			weight = w
+		}
+		throughputs = append(throughputs, float64(cs.Completed)/weight)
+		if cs.Waited > 0 {
+			waits = append(waits, cs.AverageWaitTime())
+		}
+	}
+	return JainIndex(throughputs), JainIndex(waits)
+}
+
+// ClassStats holds the counters and times of a single request class.
+type ClassStats struct {
+	Requests       int           `json:"requests"`
+	Rejected       int           `json:"rejected"`
+	Completed      int           `json:"completed"`
+	Failed         int           `json:"failed"`
+	TimedOut       int           `json:"timed_out"`
+	Interrupted    int           `json:"interrupted"`
+	Abandoned      int           `json:"abandoned"`
+	Balked         int           `json:"balked"`
+	Throttled      int           `json:"throttled"`
+	Preempted      int           `json:"preempted"` // Сколько раз обслуживание заявок класса прерывалось
+	BufferTime     time.Duration `json:"buffer_time"`
+	ProcessingTime time.Duration `json:"processing_time"`
+	ResponseTime   time.Duration `json:"response_time"` // От создания заявки до завершения обработки, включая орбиту
+	SLA            time.Duration `json:"sla"`           // Целевое время пребывания, 0 - без цели
+	WithinSLA      int           `json:"within_sla"`    // Успешно обработанные заявки, уложившиеся в SLA
+}
+
+// served returns the number of requests of the class that were not rejected, abandoned, balked or throttled.
+func (cs ClassStats) served() int {
+	return cs.Requests - cs.Rejected - cs.Abandoned - cs.Balked - cs.Throttled
+}
+
+// AverageBufferTime returns the average buffer time of the class in ms.
+func (cs ClassStats) AverageBufferTime() float64 {
+	if cs.served() <= 0 {
+		return 0.0
+	}
+	return float64(cs.BufferTime.Nanoseconds()) / float64(cs.served()) / 1e6
+}
+
+// AverageProcessingTime returns the average processing time of the class in ms.
+func (cs ClassStats) AverageProcessingTime() float64 {
+	if cs.served() <= 0 {
+		return 0.0
+	}
+	return float64(cs.ProcessingTime.Nanoseconds()) / float64(cs.served()) / 1e6
+}
+
+// AverageResponseTime returns the average time from creation to the end of processing in ms.
+func (cs ClassStats) AverageResponseTime() float64 {
+	if cs.Completed == 0 {
+		return 0.0
+	}
+	return float64(cs.ResponseTime.Nanoseconds()) / float64(cs.Completed) / 1e6
+}
+
+// SLAAttainment returns the share of processed requests that were processed successfully within the SLA.
+func (cs ClassStats) SLAAttainment() float64 {
+	if cs.Completed == 0 {
+		return 0.0
+	}
+	return float64(cs.WithinSLA) / float64(cs.Completed)
+}
+
+// SkillStats holds the counters and times of the requests that need a single skill.
+type SkillStats struct {
+	Requests   int           `json:"requests"`
+	Served     int           `json:"served"`     // Заявки, обработка которых завершилась
+	Overflowed int           `json:"overflowed"` // Заявки, отправленные специалисту с квалификацией ниже основной
+	WaitTime   time.Duration `json:"wait_time"`  // Время ожидания свободного специалиста с навыком в буфере
+	WorkTime   time.Duration `json:"work_time"`  // Время работы специалистов над заявками навыка
+}
+
+// Unserved returns the number of requests that have not been served: they left the system or are still waiting.
+func (ss SkillStats) Unserved() int {
+	return ss.Requests - ss.Served
+}
+
+// AverageWaitTime returns the average time a request waited for a specialist with the skill in ms.
+func (ss SkillStats) AverageWaitTime() float64 {
+	if ss.Served == 0 {
+		return 0.0
+	}
+	return float64(ss.WaitTime.Nanoseconds()) / float64(ss.Served) / 1e6
+}
+
+// QueueStats holds the counters and times of a single buffer of the topology.
+type QueueStats struct {
+	Placed   int           `json:"placed"`    // Заявки, поставленные в буфер
+	Spilled  int           `json:"spilled"`   // partitioned: заявки клиента, ушедшие из заполненного раздела в общую область
+	Taken    int           `json:"taken"`     // Заявки, взятые из буфера на обработку
+	WaitTime time.Duration `json:"wait_time"` // Время ожидания взятых заявок в буфере
+}
+
+// AverageWaitTime returns the average time a taken request waited in the buffer in ms.
+func (qs QueueStats) AverageWaitTime() float64 {
+	if qs.Taken == 0 {
+		return 0.0
+	}
+	return float64(qs.WaitTime.Nanoseconds()) / float64(qs.Taken) / 1e6
+}
+
+// StatsSample is a single point of the statistics time series written by LogStatistics.
+type StatsSample struct {
+	Timestamp               time.Time
+	TotalRequests           int
+	RejectedRequests        int
+	ProbabilityOfRejection  float64
+	AverageBufferTime       float64 // ms
+	AverageProcessingTime   float64 // ms
+	SpecialistWorkTimeRatio []float64
+	BufferOccupancy         int
+	OrbitSize               int
+}
+
+// StatsSnapshot is a copy of the statistics at a moment of time.
+type StatsSnapshot struct {
+	Timestamp              time.Time              `json:"timestamp"`
+	TotalRequests          int                    `json:"total_requests"`
+	RejectedRequests       int                    `json:"rejected_requests"`
+	CompletedRequests      int                    `json:"completed_requests"`
+	FailedRequests         int                    `json:"failed_requests"`
+	TimedOutRequests       int                    `json:"timed_out_requests"`
+	InterruptedRequests    int                    `json:"interrupted_requests"`
+	AbandonedRequests      int                    `json:"abandoned_requests"`
+	BalkedRequests         int                    `json:"balked_requests"`
+	Preemptions            int                    `json:"preemptions"`
+	ThrottledRequests      int                    `json:"throttled_requests"`
+	ProbabilityOfThrottle  float64                `json:"probability_of_throttling"`
+	DelayedRequests        int                    `json:"delayed_requests"`
+	AverageAdmissionDelay  float64                `json:"average_admission_delay_ms"`
+	PoolOverflows          map[string]int         `json:"pool_overflows"`
+	QueueStats             map[string]QueueStats  `json:"queue_stats,omitempty"`
+	WindowSize             time.Duration          `json:"window_size,omitempty"`
+	Windows                []WindowStats          `json:"windows,omitempty"`
+	ProbabilityOfRejection float64                `json:"probability_of_rejection"`
+	ProbabilityOfAbandon   float64                `json:"probability_of_abandonment"`
+	ProbabilityOfBalking   float64                `json:"probability_of_balking"`
+	FirstAttemptRejections int                    `json:"first_attempt_rejections"`
+	RetryAttempts          int                    `json:"retry_attempts"`
+	OrbitSize              int                    `json:"orbit_size"`
+	ProbabilityOfFirstRej  float64                `json:"probability_of_first_attempt_rejection"`
+	ProbabilityOfLoss      float64                `json:"probability_of_loss"` // Доля заявок, покинувших систему без обработки
+	AverageAttempts        float64                `json:"average_attempts"`
+	Attempts               map[int]int            `json:"attempts"`
+	AverageBufferTime      float64                `json:"average_buffer_time_ms"`
+	AverageProcessingTime  float64                `json:"average_processing_time_ms"`
+	TotalBufferTime        time.Duration          `json:"total_buffer_time"`
+	TotalProcessingTime    time.Duration          `json:"total_processing_time"`
+	TotalSystemTime        time.Duration          `json:"total_system_time"`
+	BufferOccupancy        int                    `json:"buffer_occupancy"`
+	SpecialistUsage        map[int]int            `json:"specialist_usage"`
+	SpecialistWorkTime     map[int]time.Duration  `json:"specialist_work_time"`
+	ClientStats            map[string]ClientStats `json:"client_stats"`
+	ClassStats             map[string]ClassStats  `json:"class_stats"`
+	SkillStats             map[string]SkillStats  `json:"skill_stats"`
 }
 
 // NewStatsManager creates a new StatsManager and initializes the log file.
@@ -48,9 +323,17 @@ func NewStatsManager(filename string, spec_num int) (*StatsManager, error) {
 	sm := &StatsManager{
 		SpecialistUsage:    make(map[int]int),
 		SpecialistWorkTime: make(map[int]time.Duration),
+		ClientStats:        make(map[string]*ClientStats),
+		ClassStats:         make(map[string]*ClassStats),
+		SkillStats:         make(map[string]*SkillStats),
+		PoolOverflows:      make(map[string]int),
+		QueueStats:         make(map[string]*QueueStats),
+		Attempts:           make(map[int]int),
 		File:               file,
 		LastLogTime:        time.Now(),
 		logChannel:         make(chan string, 100), // Буферизованный канал
+		writerDone:         make(chan struct{}),
+		sampleStride:       1,
 	}
 
 	// Запуск горутины для записи логов в файл
@@ -60,34 +343,309 @@ func NewStatsManager(filename string, spec_num int) (*StatsManager, error) {
 }
 
 // RecordRequest records a new request and updates the total request count.
-func (sm *StatsManager) RecordRequest() {
-	//sm.mu.Lock()
-	// defer sm.mu.Unlock()
+func (sm *StatsManager) RecordRequest(request *Request) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
 	sm.TotalRequests++
-	//sm.mu.Unlock()
+	if w := sm.window(time.Now()); w != nil {
+		w.Requests++
+	}
+	sm.clientStats(request.Client.ID).Requests++
+	sm.classStats(request).Requests++
+	if ss := sm.skillStats(request); ss != nil {
+		ss.Requests++
+	}
 }
 
-// RecordRejectedRequest records a rejected request.
-func (sm *StatsManager) RecordRejectedRequest() {
-	//sm.mu.Lock()
-	// defer sm.mu.Unlock()
+// RecordRejectedRequest records a request that was rejected and will not come back.
+func (sm *StatsManager) RecordRejectedRequest(request *Request) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
 	sm.RejectedRequests++
-	//sm.mu.Unlock()
+	if w := sm.window(time.Now()); w != nil {
+		w.Rejected++
+	}
+	sm.clientStats(request.Client.ID).Rejected++
+	sm.classStats(request).Rejected++
+	if request.Attempts <= 1 {
+		sm.FirstAttemptRejections++
+	}
+	sm.recordAttempts(request)
+}
+
+// RecordThrottledRequest records a request rejected by the rate limit of its client before it entered the system.
+func (sm *StatsManager) RecordThrottledRequest(request *Request) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	sm.ThrottledRequests++
+	if w := sm.window(time.Now()); w != nil {
+		w.Throttled++
+	}
+	sm.clientStats(request.Client.ID).Throttled++
+	sm.classStats(request).Throttled++
+}
+
+// RecordDelayedRequest records a request that waits for delay before the rate limit of its client lets it in.
+func (sm *StatsManager) RecordDelayedRequest(request *Request, delay time.Duration) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	sm.DelayedRequests++
+	sm.AdmissionDelay += delay
+	cs := sm.clientStats(request.Client.ID)
+	cs.Delayed++
+	cs.AdmissionDelay += delay
+}
+
+// RecordOrbitEntry records a rejected request that went to the orbit, which now holds orbitSize requests.
+func (sm *StatsManager) RecordOrbitEntry(request *Request, orbitSize int) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	if request.Attempts <= 1 {
+		sm.FirstAttemptRejections++
+	}
+	sm.orbitSize = orbitSize
+}
+
+// RecordRetry records a request that came back from the orbit, which now holds orbitSize requests.
+func (sm *StatsManager) RecordRetry(request *Request, orbitSize int) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	sm.RetryAttempts++
+	sm.orbitSize = orbitSize
+}
+
+// RecordOrbitLoss records a request that was still in the orbit when the run ended, which now holds orbitSize requests.
+// It is lost like a rejected request, but its first rejection was already counted by RecordOrbitEntry.
+func (sm *StatsManager) RecordOrbitLoss(request *Request, orbitSize int) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	sm.RejectedRequests++
+	if w := sm.window(time.Now()); w != nil {
+		w.Rejected++
+	}
+	sm.clientStats(request.Client.ID).Rejected++
+	sm.classStats(request).Rejected++
+	sm.recordAttempts(request)
+	sm.orbitSize = orbitSize
+}
+
+// recordAttempts records the number of attempts of a request that left the system. sm.mu must be held.
+func (sm *StatsManager) recordAttempts(request *Request) {
+	attempts := request.Attempts
+	if attempts < 1 {
+		attempts = 1
+	}
+	sm.Attempts[attempts]++
+}
+
+// RecordAbandonedRequest records a request whose client ran out of patience while it waited in the buffer.
+func (sm *StatsManager) RecordAbandonedRequest(request *Request) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	sm.AbandonedRequests++
+	if w := sm.window(time.Now()); w != nil {
+		w.Abandoned++
+	}
+	sm.clientStats(request.Client.ID).Abandoned++
+	sm.classStats(request).Abandoned++
+	sm.recordAttempts(request)
+}
+
+// RecordBalkedRequest records a request whose client refused to join the queue.
+func (sm *StatsManager) RecordBalkedRequest(request *Request) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	sm.BalkedRequests++
+	if w := sm.window(time.Now()); w != nil {
+		w.Balked++
+	}
+	sm.clientStats(request.Client.ID).Balked++
+	sm.classStats(request).Balked++
+	sm.recordAttempts(request)
+}
+
+// RecordPreemption records a request whose processing was interrupted by a request with a higher priority.
+func (sm *StatsManager) RecordPreemption(request *Request) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	sm.Preemptions++
+	sm.classStats(request).Preempted++
+}
+
+// RecordCompletedRequest records the end of processing of a request with the error of the handler, if any.
+func (sm *StatsManager) RecordCompletedRequest(request *Request, err error) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	class := sm.classStats(request)
+	if errors.Is(err, context.Canceled) {
+		// Обработка прервана остановкой системы, заявка не считается обработанной
+		sm.InterruptedRequests++
+		class.Interrupted++
+		return
+	}
+
+	if ss := sm.skillStats(request); ss != nil {
+		ss.Served++
+	}
+	cs := sm.clientStats(request.Client.ID)
+	sm.CompletedRequests++
+	cs.Completed++
+	class.Completed++
+	sm.recordAttempts(request)
+
+	now := time.Now()
+	responseTime := now.Sub(request.CreatedAt)
+	class.ResponseTime += responseTime
+	cs.ResponseTime += responseTime
+	if w := sm.window(now); w != nil {
+		w.Completed++
+		w.ResponseTime += responseTime
+	}
+	if err != nil {
+		sm.FailedRequests++
+		cs.Failed++
+		class.Failed++
+		if errors.Is(err, context.DeadlineExceeded) {
+			sm.TimedOutRequests++
+			class.TimedOut++
+		}
+	} else if class.SLA > 0 && responseTime <= class.SLA {
+		class.WithinSLA++
+	}
+}
+
+// clientStats returns the counters of the client, creating them if needed. sm.mu must be held.
+func (sm *StatsManager) clientStats(clientID string) *ClientStats {
+	cs, ok := sm.ClientStats[clientID]
+	if !ok {
+		cs = &ClientStats{}
+		sm.ClientStats[clientID] = cs
+	}
+	return cs
+}
+
+// classStats returns the counters of the class of the request, creating them if needed. sm.mu must be held.
+func (sm *StatsManager) classStats(request *Request) *ClassStats {
+	name := request.ClassName()
+	cs, ok := sm.ClassStats[name]
+	if !ok {
+		cs = &ClassStats{}
+		if request.Class != nil {
+			cs.SLA = request.Class.SLA
+		}
+		sm.ClassStats[name] = cs
+	}
+	return cs
+}
+
+// skillStats returns the counters of the skill needed by the request, creating them if needed,
+// or nil if the request needs no skill. sm.mu must be held.
+func (sm *StatsManager) skillStats(request *Request) *SkillStats {
+	skill := request.Skill()
+	if skill == "" {
+		return nil
+	}
+	ss, ok := sm.SkillStats[skill]
+	if !ok {
+		ss = &SkillStats{}
+		sm.SkillStats[skill] = ss
+	}
+	return ss
+}
+
+// RecordOverflow records a request sent to a specialist less skilled than the primary ones.
+func (sm *StatsManager) RecordOverflow(request *Request) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	if ss := sm.skillStats(request); ss != nil {
+		ss.Overflowed++
+	}
+}
+
+// RecordPoolOverflow records a request of the pool sent to a specialist of another pool.
+func (sm *StatsManager) RecordPoolOverflow(pool string) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	sm.PoolOverflows[pool]++
+}
+
+// queueStats returns the statistics of the buffer of the topology, creating them if needed. sm.mu must be held.
+func (sm *StatsManager) queueStats(queue string) *QueueStats {
+	qs, ok := sm.QueueStats[queue]
+	if !ok {
+		qs = &QueueStats{}
+		sm.QueueStats[queue] = qs
+	}
+	return qs
+}
+
+// RecordQueuePlacement records a request placed in the buffer of the topology.
+// partition is the client whose full partition the request spilled over from, "" if it did not.
+func (sm *StatsManager) RecordQueuePlacement(queue, partition string) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	sm.queueStats(queue).Placed++
+	if partition != "" {
+		sm.queueStats(partition).Spilled++
+	}
+}
+
+// RecordQueueTake records a request taken from the buffer of the topology after waiting there for wait.
+func (sm *StatsManager) RecordQueueTake(queue string, wait time.Duration) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	qs := sm.queueStats(queue)
+	qs.Taken++
+	qs.WaitTime += wait
 }
 
 // RecordBufferTime records the time a request spent in the buffer.
-func (sm *StatsManager) RecordBufferTime(duration time.Duration) {
+func (sm *StatsManager) RecordBufferTime(request *Request, duration time.Duration) {
 	sm.mu.Lock()
 	// defer sm.mu.Unlock()
 	sm.TotalBufferTime += duration
+	sm.classStats(request).BufferTime += duration
+	cs := sm.clientStats(request.Client.ID)
+	cs.Waited++
+	cs.WaitTime += duration
+	if ss := sm.skillStats(request); ss != nil {
+		ss.WaitTime += duration
+	}
+	sm.sampleWaitTime(duration)
+	if w := sm.window(time.Now()); w != nil {
+		w.Waited++
+		w.WaitTime += duration
+	}
 	sm.mu.Unlock()
 }
 
+// waitSampleSize is the number of waiting times kept for the histogram. The memory does not grow
+// with the length of the run, and the sample stays uniform over the whole run.
+const waitSampleSize = 10000
+
+// sampleWaitTime adds a waiting time to the reservoir sample WaitTimes. sm.mu must be held.
+func (sm *StatsManager) sampleWaitTime(duration time.Duration) {
+	sm.waitsSeen++
+	if len(sm.WaitTimes) < waitSampleSize {
+		sm.WaitTimes = append(sm.WaitTimes, duration)
+		return
+	}
+	// Новое значение заменяет случайное с вероятностью waitSampleSize / waitsSeen
+	if i := rand.Intn(sm.waitsSeen); i < waitSampleSize {
+		sm.WaitTimes[i] = duration
+	}
+}
+
 // RecordProcessingTime records the time a request spent being processed.
-func (sm *StatsManager) RecordProcessingTime(duration time.Duration) {
+func (sm *StatsManager) RecordProcessingTime(request *Request, duration time.Duration) {
 	sm.mu.Lock()
 	// defer sm.mu.Unlock()
 	sm.TotalProcessingTime += duration
+	sm.classStats(request).ProcessingTime += duration
+	if ss := sm.skillStats(request); ss != nil {
+		ss.WorkTime += duration
+	}
 	sm.mu.Unlock()
 }
 
@@ -103,6 +661,7 @@ func (sm *StatsManager) RecordSpecialistWorkTime(specialistID int, workTime time
 	sm.mu.Lock()
 	// defer sm.mu.Unlock()
 	sm.SpecialistWorkTime[specialistID] += workTime
+	sm.recordWindowWork(time.Now(), workTime)
 	// sm.TotalSystemTime += workTime
 	sm.mu.Unlock()
 }
@@ -114,34 +673,134 @@ func (sm *StatsManager) RecordWorkTime(workTime time.Duration) {
 	sm.mu.Unlock()
 }
 
+// RecordBufferOccupancy records the current number of requests in the buffer.
+func (sm *StatsManager) RecordBufferOccupancy(occupancy int) {
+	sm.mu.Lock()
+	sm.bufferOccupancy = occupancy
+	if w := sm.window(time.Now()); w != nil && occupancy > w.MaxOccupancy {
+		w.MaxOccupancy = occupancy
+	}
+	sm.mu.Unlock()
+}
+
 // CalculateProbabilityOfRejection calculates the probability of rejection.
 func (sm *StatsManager) CalculateProbabilityOfRejection() float64 {
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
-	if sm.TotalRequests == 0 {
-		return 0.0
-	}
-	return float64(sm.RejectedRequests) / float64(sm.TotalRequests)
+	return sm.probabilityOfRejection()
 }
 
 // CalculateAverageBufferTime calculates the average time a request spends in the buffer.
 func (sm *StatsManager) CalculateAverageBufferTime() float64 {
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
-	if sm.TotalRequests == 0 {
-		return 0.0
-	}
-	return float64(sm.TotalBufferTime.Nanoseconds()) / float64(sm.TotalRequests-sm.RejectedRequests) / 1e6 // Convert to milliseconds
+	return sm.averageBufferTime()
 }
 
 // CalculateAverageProcessingTime calculates the average time a request spends being processed.
 func (sm *StatsManager) CalculateAverageProcessingTime() float64 {
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
+	return sm.averageProcessingTime()
+}
+
+// CalculateProbabilityOfAbandonment calculates the probability that a client leaves before its request is processed.
+func (sm *StatsManager) CalculateProbabilityOfAbandonment() float64 {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	return sm.probabilityOfAbandonment()
+}
+
+// CalculateProbabilityOfBalking calculates the probability that a client refuses to join the queue.
+func (sm *StatsManager) CalculateProbabilityOfBalking() float64 {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	return sm.probabilityOfBalking()
+}
+
+// probabilityOfRejection calculates the probability of rejection. sm.mu must be held.
+func (sm *StatsManager) probabilityOfRejection() float64 {
+	if sm.TotalRequests == 0 {
+		return 0.0
+	}
+	return float64(sm.RejectedRequests) / float64(sm.TotalRequests)
+}
+
+// probabilityOfAbandonment calculates the probability of abandonment. sm.mu must be held.
+func (sm *StatsManager) probabilityOfAbandonment() float64 {
+	if sm.TotalRequests == 0 {
+		return 0.0
+	}
+	return float64(sm.AbandonedRequests) / float64(sm.TotalRequests)
+}
+
+// probabilityOfBalking calculates the probability of balking. sm.mu must be held.
+func (sm *StatsManager) probabilityOfBalking() float64 {
+	if sm.TotalRequests == 0 {
+		return 0.0
+	}
+	return float64(sm.BalkedRequests) / float64(sm.TotalRequests)
+}
+
+// probabilityOfFirstRejection calculates the probability that the first attempt is rejected. sm.mu must be held.
+func (sm *StatsManager) probabilityOfFirstRejection() float64 {
+	if sm.TotalRequests == 0 {
+		return 0.0
+	}
+	return float64(sm.FirstAttemptRejections) / float64(sm.TotalRequests)
+}
+
+// probabilityOfLoss calculates the probability that a request leaves without processing. sm.mu must be held.
+func (sm *StatsManager) probabilityOfLoss() float64 {
+	if sm.TotalRequests == 0 {
+		return 0.0
+	}
+	return float64(sm.RejectedRequests+sm.AbandonedRequests+sm.BalkedRequests+sm.ThrottledRequests) / float64(sm.TotalRequests)
+}
+
+// probabilityOfThrottling calculates the probability that a request is rejected by the rate limit. sm.mu must be held.
+func (sm *StatsManager) probabilityOfThrottling() float64 {
 	if sm.TotalRequests == 0 {
 		return 0.0
 	}
-	return float64(sm.TotalProcessingTime.Nanoseconds()) / float64(sm.TotalRequests-sm.RejectedRequests) / 1e6 // Convert to milliseconds
+	return float64(sm.ThrottledRequests) / float64(sm.TotalRequests)
+}
+
+// averageAdmissionDelay calculates the average wait of the delayed requests for admission in ms. sm.mu must be held.
+func (sm *StatsManager) averageAdmissionDelay() float64 {
+	if sm.DelayedRequests == 0 {
+		return 0.0
+	}
+	return float64(sm.AdmissionDelay.Nanoseconds()) / float64(sm.DelayedRequests) / 1e6
+}
+
+// averageAttempts calculates the average number of attempts per request. sm.mu must be held.
+func (sm *StatsManager) averageAttempts() float64 {
+	if sm.TotalRequests == 0 {
+		return 0.0
+	}
+	return float64(sm.TotalRequests+sm.RetryAttempts) / float64(sm.TotalRequests)
+}
+
+// served returns the number of requests that were not rejected, abandoned, balked or throttled. sm.mu must be held.
+func (sm *StatsManager) served() int {
+	return sm.TotalRequests - sm.RejectedRequests - sm.AbandonedRequests - sm.BalkedRequests - sm.ThrottledRequests
+}
+
+// averageBufferTime calculates the average buffer time in ms. sm.mu must be held.
+func (sm *StatsManager) averageBufferTime() float64 {
+	if sm.served() <= 0 {
+		return 0.0
+	}
+	return float64(sm.TotalBufferTime.Nanoseconds()) / float64(sm.served()) / 1e6 // Convert to milliseconds
+}
+
+// averageProcessingTime calculates the average processing time in ms. sm.mu must be held.
+func (sm *StatsManager) averageProcessingTime() float64 {
+	if sm.served() <= 0 {
+		return 0.0
+	}
+	return float64(sm.TotalProcessingTime.Nanoseconds()) / float64(sm.served()) / 1e6 // Convert to milliseconds
 }
 
 // CalculateSpecialistLoad calculates the load of each specialist.
@@ -157,19 +816,51 @@ func (sm *StatsManager) CalculateSpecialistLoad(totalSpecialists int) map[int]fl
 
 // LogStatistics logs the current statistics to the file.
 func (sm *StatsManager) LogStatistics(totalSpecialists int, createdAtTimes []time.Time) {
+	sm.mu.Lock()
 	// Check if 100ms have passed since the last log
 	if time.Since(sm.LastLogTime) < 100*time.Millisecond {
+		sm.mu.Unlock()
 		return
 	}
+	logEntry, send := sm.writeStatistics(totalSpecialists, createdAtTimes)
+	sm.mu.Unlock()
+
+	if send {
+		sm.sendLog(logEntry)
+	}
+}
+
+// Flush logs the current statistics regardless of the time of the last log.
+// It is used to record the final state of the system.
+func (sm *StatsManager) Flush(totalSpecialists int, createdAtTimes []time.Time) {
+	sm.mu.Lock()
+	logEntry, send := sm.writeStatistics(totalSpecialists, createdAtTimes)
+	sm.mu.Unlock()
+
+	if send {
+		sm.sendLog(logEntry)
+	}
+}
+
+// sendLog passes the log entry prepared by writeStatistics to logWriter. It is called without sm.mu,
+// so waiting for a slow writer does not stall the Record calls, and no entry is ever dropped.
+func (sm *StatsManager) sendLog(logEntry string) {
+	defer sm.sending.Done()
+	sm.logChannel <- logEntry
+}
 
-	probRejection := sm.CalculateProbabilityOfRejection()
-	avgBufferTime := sm.CalculateAverageBufferTime()
-	avgProcessingTime := sm.CalculateAverageProcessingTime()
-	// specialistLoad := sm.CalculateSpecialistLoad(totalSpecialists)
+// writeStatistics formats the current statistics for the log file and appends a sample to the history.
+// sm.mu must be held, so the logged values are consistent with each other. If send is true,
+// the entry has to be passed to sendLog after sm.mu is released; Close waits for it.
+func (sm *StatsManager) writeStatistics(totalSpecialists int, createdAtTimes []time.Time) (logEntry string, send bool) {
+	probRejection := sm.probabilityOfRejection()
+	avgBufferTime := sm.averageBufferTime()
+	avgProcessingTime := sm.averageProcessingTime()
 
 	// Prepare the log entry
-	logEntry := fmt.Sprintf("%s,%d,%d,%.4f,%.6f,%.6f",
-		time.Now().Format(time.RFC3339Nano),
+	now := time.Now()
+	logEntry = fmt.Sprintf("%s,%d,%d,%.4f,%.6f,%.6f",
+		now.Format(time.RFC3339Nano),
 		sm.TotalRequests,
 		sm.RejectedRequests,
 		probRejection,
@@ -177,33 +868,159 @@ func (sm *StatsManager) LogStatistics(totalSpecialists int, createdAtTimes []tim
 		avgProcessingTime,
 	)
 
-	// Add specialist loads
-	// for i := 1; i <= totalSpecialists; i++ {
-	// 	logEntry += fmt.Sprintf(",%.4f", specialistLoad[i])
-	// }
+	sample := StatsSample{
+		Timestamp:               now,
+		TotalRequests:           sm.TotalRequests,
+		RejectedRequests:        sm.RejectedRequests,
+		ProbabilityOfRejection:  probRejection,
+		AverageBufferTime:       avgBufferTime,
+		AverageProcessingTime:   avgProcessingTime,
+		SpecialistWorkTimeRatio: make([]float64, 0, totalSpecialists),
+	}
 
 	// Add specialist loads
 	for i := 1; i <= totalSpecialists; i++ {
-		specialistWorkTimeRatio := float64(sm.SpecialistWorkTime[i]) / float64(time.Since(createdAtTimes[i-1]))
+		specialistWorkTimeRatio := float64(sm.SpecialistWorkTime[i]) / float64(now.Sub(createdAtTimes[i-1]))
 		if specialistWorkTimeRatio >= 1.0 {
-			logEntry += fmt.Sprintf(",%.4f", 1.0)
-		} else {
-			logEntry += fmt.Sprintf(",%.4f", specialistWorkTimeRatio)
+			specialistWorkTimeRatio = 1.0
 		}
-
+		logEntry += fmt.Sprintf(",%.4f", specialistWorkTimeRatio)
+		sample.SpecialistWorkTimeRatio = append(sample.SpecialistWorkTimeRatio, specialistWorkTimeRatio)
 	}
+	sample.BufferOccupancy = sm.bufferOccupancy
+	sample.OrbitSize = sm.orbitSize
+	sm.addSample(sample)
 
 	logEntry += "\n"
 
-	// Send log entry to the channel
-	sm.logChannel <- logEntry
-
 	// Update the last log time
 	sm.LastLogTime = time.Now()
+
+	// The file takes entries until it is closed
+	if sm.closed {
+		return logEntry, false
+	}
+	sm.sending.Add(1)
+	return logEntry, true
+}
+
+// Snapshot returns an immutable copy of the current statistics that is safe to use from other goroutines.
+// All values are taken under one lock, so they are consistent with each other.
+func (sm *StatsManager) Snapshot() StatsSnapshot {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	snapshot := StatsSnapshot{
+		Timestamp:              time.Now(),
+		TotalRequests:          sm.TotalRequests,
+		RejectedRequests:       sm.RejectedRequests,
+		CompletedRequests:      sm.CompletedRequests,
+		FailedRequests:         sm.FailedRequests,
+		TimedOutRequests:       sm.TimedOutRequests,
+		InterruptedRequests:    sm.InterruptedRequests,
+		AbandonedRequests:      sm.AbandonedRequests,
+		BalkedRequests:         sm.BalkedRequests,
+		Preemptions:            sm.Preemptions,
+		ThrottledRequests:      sm.ThrottledRequests,
+		ProbabilityOfThrottle:  sm.probabilityOfThrottling(),
+		DelayedRequests:        sm.DelayedRequests,
+		AverageAdmissionDelay:  sm.averageAdmissionDelay(),
+		ProbabilityOfRejection: sm.probabilityOfRejection(),
+		ProbabilityOfAbandon:   sm.probabilityOfAbandonment(),
+		ProbabilityOfBalking:   sm.probabilityOfBalking(),
+		FirstAttemptRejections: sm.FirstAttemptRejections,
+		RetryAttempts:          sm.RetryAttempts,
+		OrbitSize:              sm.orbitSize,
+		ProbabilityOfFirstRej:  sm.probabilityOfFirstRejection(),
+		ProbabilityOfLoss:      sm.probabilityOfLoss(),
+		AverageAttempts:        sm.averageAttempts(),
+		Attempts:               make(map[int]int, len(sm.Attempts)),
+		AverageBufferTime:      sm.averageBufferTime(),
+		AverageProcessingTime:  sm.averageProcessingTime(),
+		TotalBufferTime:        sm.TotalBufferTime,
+		TotalProcessingTime:    sm.TotalProcessingTime,
+		TotalSystemTime:        sm.TotalSystemTime,
+		BufferOccupancy:        sm.bufferOccupancy,
+		SpecialistUsage:        make(map[int]int, len(sm.SpecialistUsage)),
+		SpecialistWorkTime:     make(map[int]time.Duration, len(sm.SpecialistWorkTime)),
+		ClientStats:            make(map[string]ClientStats, len(sm.ClientStats)),
+		ClassStats:             make(map[string]ClassStats, len(sm.ClassStats)),
+		SkillStats:             make(map[string]SkillStats, len(sm.SkillStats)),
+		PoolOverflows:          make(map[string]int, len(sm.PoolOverflows)),
+		QueueStats:             make(map[string]QueueStats, len(sm.QueueStats)),
+		WindowSize:             sm.WindowSize,
+		Windows:                sm.windows(),
+	}
+	for id, count := range sm.SpecialistUsage {
+		snapshot.SpecialistUsage[id] = count
+	}
+	for id, workTime := range sm.SpecialistWorkTime {
+		snapshot.SpecialistWorkTime[id] = workTime
+	}
+	for id, cs := range sm.ClientStats {
+		snapshot.ClientStats[id] = *cs
+	}
+	for name, cs := range sm.ClassStats {
+		snapshot.ClassStats[name] = *cs
+	}
+	for pool, count := range sm.PoolOverflows {
+		snapshot.PoolOverflows[pool] = count
+	}
+	for skill, ss := range sm.SkillStats {
+		snapshot.SkillStats[skill] = *ss
+	}
+	for name, qs := range sm.QueueStats {
+		snapshot.QueueStats[name] = *qs
+	}
+	for attempts, count := range sm.Attempts {
+		snapshot.Attempts[attempts] = count
+	}
+	return snapshot
+}
+
+// sampleHistorySize is the number of points kept in Samples. When the history is full, every other point
+// is dropped and only every second new point is kept, so the history covers the whole run at a coarser step.
+const sampleHistorySize = 2000
+
+// addSample adds a point to the history Samples. sm.mu must be held.
+func (sm *StatsManager) addSample(sample StatsSample) {
+	n := sm.samplesSeen
+	sm.samplesSeen++
+	if n%sm.sampleStride != 0 {
+		sm.latestSample = &sample
+		return
+	}
+	if len(sm.Samples) == sampleHistorySize {
+		// Остаются точки с четными номерами, шаг удваивается; номер новой точки делится на новый шаг
+		for i := 0; i < sampleHistorySize/2; i++ {
+			sm.Samples[i] = sm.Samples[2*i]
+		}
+		sm.Samples = sm.Samples[:sampleHistorySize/2]
+		sm.sampleStride *= 2
+	}
+	sm.Samples = append(sm.Samples, sample)
+	sm.latestSample = nil
+}
+
+// history returns copies of the recorded samples and of the sample of waiting times.
+// The last recorded point is always included, so the samples end at the final state of the run.
+func (sm *StatsManager) history() ([]StatsSample, []time.Duration) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	samples := make([]StatsSample, len(sm.Samples), len(sm.Samples)+1)
+	copy(samples, sm.Samples)
+	if sm.latestSample != nil {
+		samples = append(samples, *sm.latestSample)
+	}
+	waitTimes := make([]time.Duration, len(sm.WaitTimes))
+	copy(waitTimes, sm.WaitTimes)
+	return samples, waitTimes
 }
 
 // logWriter writes log entries from the channel to the file.
 func (sm *StatsManager) logWriter() {
+	defer close(sm.writerDone)
 	for entry := range sm.logChannel {
 		_, err := sm.File.WriteString(entry)
 		if err != nil {
@@ -212,8 +1029,19 @@ func (sm *StatsManager) logWriter() {
 	}
 }
 
-// Close closes the log file.
+// Close waits until all log entries are written and closes the log file.
 func (sm *StatsManager) Close() {
+	sm.mu.Lock()
+	if sm.closed {
+		sm.mu.Unlock()
+		return
+	}
+	sm.closed = true
+	sm.mu.Unlock()
+
+	// Строки, подготовленные до закрытия, дописываются в файл
+	sm.sending.Wait()
 	close(sm.logChannel) // Закрываем канал, чтобы завершить горутину logWriter
+	<-sm.writerDone
 	sm.File.Close()
 }
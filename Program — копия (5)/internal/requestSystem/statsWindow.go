@@ -0,0 +1,132 @@
+package requestsystem
+
+import "time"
+
+// WindowStats holds the counters of a single time window of the run, so that the load peaks
+// are seen apart instead of being averaged over the whole run.
+// A request is counted in the window it arrived, waited, left or was processed in.
+type WindowStats struct {
+	Start        time.Duration `json:"start"`    // Смещение начала окна от начала работы
+	Duration     time.Duration `json:"duration"` // Длительность окна; последнее окно может быть короче
+	Requests     int           `json:"requests"`
+	Rejected     int           `json:"rejected"`
+	Throttled    int           `json:"throttled"`
+	Abandoned    int           `json:"abandoned"`
+	Balked       int           `json:"balked"`
+	Completed    int           `json:"completed"`
+	Waited       int           `json:"waited"`        // Заявки, взятые из буфера
+	WaitTime     time.Duration `json:"wait_time"`     // Время ожидания взятых из буфера заявок
+	ResponseTime time.Duration `json:"response_time"` // Время от создания до конца обработки обработанных заявок
+	WorkTime     time.Duration `json:"work_time"`     // Время работы всех специалистов в окне
+	MaxOccupancy int           `json:"max_occupancy"` // Наибольшее заполнение буферов
+}
+
+// ArrivalRate returns the number of requests that arrived per second of the window.
+func (ws WindowStats) ArrivalRate() float64 {
+	if ws.Duration <= 0 {
+		return 0.0
+	}
+	return float64(ws.Requests) / ws.Duration.Seconds()
+}
+
+// Lost returns the number of requests that left the system without processing in the window.
+func (ws WindowStats) Lost() int {
+	return ws.Rejected + ws.Throttled + ws.Abandoned + ws.Balked
+}
+
+// ProbabilityOfLoss returns the share of requests lost in the window among those that left it.
+func (ws WindowStats) ProbabilityOfLoss() float64 {
+	left := ws.Lost() + ws.Completed
+	if left == 0 {
+		return 0.0
+	}
+	return float64(ws.Lost()) / float64(left)
+}
+
+// AverageWaitTime returns the average time in the buffer of the requests taken from it in the window in ms.
+func (ws WindowStats) AverageWaitTime() float64 {
+	if ws.Waited == 0 {
+		return 0.0
+	}
+	return float64(ws.WaitTime.Nanoseconds()) / float64(ws.Waited) / 1e6
+}
+
+// AverageResponseTime returns the average response time of the requests processed in the window in ms.
+func (ws WindowStats) AverageResponseTime() float64 {
+	if ws.Completed == 0 {
+		return 0.0
+	}
+	return float64(ws.ResponseTime.Nanoseconds()) / float64(ws.Completed) / 1e6
+}
+
+// Utilization returns the share of the window the specialists spent working.
+func (ws WindowStats) Utilization(specialists int) float64 {
+	if ws.Duration <= 0 || specialists == 0 {
+		return 0.0
+	}
+	return ws.WorkTime.Seconds() / ws.Duration.Seconds() / float64(specialists)
+}
+
+// StartWindows starts splitting the statistics into windows of the given size from now.
+// A non-positive size turns the windows off.
+func (sm *StatsManager) StartWindows(size time.Duration) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	sm.WindowSize = size
+	sm.Windows = nil
+	sm.windowsStart = time.Now()
+	sm.windowsEnd = 0
+	if size <= 0 {
+		sm.WindowSize = 0
+	}
+}
+
+// window returns the window of the moment now, creating it and the windows before it if needed,
+// or nil if the statistics are not split into windows. sm.mu must be held.
+func (sm *StatsManager) window(now time.Time) *WindowStats {
+	if sm.WindowSize == 0 {
+		return nil
+	}
+	offset := now.Sub(sm.windowsStart)
+	if offset < 0 {
+		offset = 0
+	}
+	if offset > sm.windowsEnd {
+		sm.windowsEnd = offset
+	}
+	i := int(offset / sm.WindowSize)
+	for len(sm.Windows) <= i {
+		start := time.Duration(len(sm.Windows)) * sm.WindowSize
+		sm.Windows = append(sm.Windows, &WindowStats{Start: start, Duration: sm.WindowSize})
+	}
+	return sm.Windows[i]
+}
+
+// recordWindowWork divides the work time that ended at now between the windows it spans. sm.mu must be held.
+func (sm *StatsManager) recordWindowWork(now time.Time, workTime time.Duration) {
+	if sm.window(now) == nil {
+		return
+	}
+	end := now.Sub(sm.windowsStart)
+	// Работа до начала окон не учитывается
+	for offset := max(end-workTime, 0); offset < end; {
+		i := int(offset / sm.WindowSize)
+		part := min(time.Duration(i+1)*sm.WindowSize, end) - offset
+		sm.Windows[i].WorkTime += part
+		offset += part
+	}
+}
+
+// windows returns copies of the windows; the last one lasts until the latest recorded moment. sm.mu must be held.
+func (sm *StatsManager) windows() []WindowStats {
+	if len(sm.Windows) == 0 {
+		return nil
+	}
+	windows := make([]WindowStats, len(sm.Windows))
+	for i, w := range sm.Windows {
+		windows[i] = *w
+	}
+	last := &windows[len(windows)-1]
+	last.Duration = sm.windowsEnd - last.Start
+	return windows
+}
@@ -0,0 +1,106 @@
+package requestsystem
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestWindowStats(t *testing.T) {
+	tests := []struct {
+		name        string
+		ws          WindowStats
+		rate        float64
+		loss        float64
+		wait        float64
+		response    float64
+		utilization float64
+		specialists int
+	}{
+		{"empty", WindowStats{}, 0, 0, 0, 0, 0, 2},
+		{"busy window", WindowStats{
+			Duration:     2 * time.Second,
+			Requests:     10,
+			Rejected:     1,
+			Throttled:    1,
+			Abandoned:    1,
+			Balked:       1,
+			Completed:    4,
+			Waited:       2,
+			WaitTime:     30 * time.Millisecond,
+			ResponseTime: 100 * time.Millisecond,
+			WorkTime:     3 * time.Second,
+		}, 5, 0.5, 15, 25, 0.75, 2},
+		{"no specialists", WindowStats{Duration: time.Second, WorkTime: time.Second}, 0, 0, 0, 0, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.ws.ArrivalRate(); got != tt.rate {
+				t.Errorf("ArrivalRate() = %v, want %v", got, tt.rate)
+			}
+			if got := tt.ws.ProbabilityOfLoss(); got != tt.loss {
+				t.Errorf("ProbabilityOfLoss() = %v, want %v", got, tt.loss)
+			}
+			if got := tt.ws.AverageWaitTime(); got != tt.wait {
+				t.Errorf("AverageWaitTime() = %v, want %v", got, tt.wait)
+			}
+			if got := tt.ws.AverageResponseTime(); got != tt.response {
+				t.Errorf("AverageResponseTime() = %v, want %v", got, tt.response)
+			}
+			if got := tt.ws.Utilization(tt.specialists); got != tt.utilization {
+				t.Errorf("Utilization(%d) = %v, want %v", tt.specialists, got, tt.utilization)
+			}
+		})
+	}
+}
+
+func TestRecordWindowWork(t *testing.T) {
+	const size = 100 * time.Millisecond
+	tests := []struct {
+		name     string
+		end      time.Duration // Конец работы от начала окон
+		workTime time.Duration
+		want     []time.Duration // Время работы по окнам
+	}{
+		{"inside one window", 50 * time.Millisecond, 30 * time.Millisecond, []time.Duration{30 * time.Millisecond}},
+		{"across a boundary", 150 * time.Millisecond, 100 * time.Millisecond,
+			[]time.Duration{50 * time.Millisecond, 50 * time.Millisecond}},
+		{"across several windows", 260 * time.Millisecond, 250 * time.Millisecond,
+			[]time.Duration{90 * time.Millisecond, 100 * time.Millisecond, 60 * time.Millisecond}},
+		{"ends at a boundary", 200 * time.Millisecond, 100 * time.Millisecond,
+			[]time.Duration{0, 100 * time.Millisecond, 0}},
+		{"started before the windows", 50 * time.Millisecond, 200 * time.Millisecond, []time.Duration{50 * time.Millisecond}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sm := newTestStatsManager(t, 1)
+			sm.StartWindows(size)
+
+			sm.mu.Lock()
+			sm.recordWindowWork(sm.windowsStart.Add(tt.end), tt.workTime)
+			windows := sm.windows()
+			sm.mu.Unlock()
+
+			got := make([]time.Duration, len(windows))
+			for i, w := range windows {
+				got[i] = w.WorkTime
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("work by windows = %v, want %v", got, tt.want)
+			}
+			if last := windows[len(windows)-1]; last.Start+last.Duration != tt.end {
+				t.Errorf("last window ends at %v, want %v", last.Start+last.Duration, tt.end)
+			}
+		})
+	}
+}
+
+func TestWindowsOff(t *testing.T) {
+	sm := newTestStatsManager(t, 1)
+	sm.StartWindows(0)
+	sm.RecordRequest(&Request{Client: &Client{ID: "1"}})
+	sm.RecordSpecialistWorkTime(1, time.Second)
+	if windows := sm.Snapshot().Windows; windows != nil {
+		t.Errorf("Windows = %v, want none", windows)
+	}
+}
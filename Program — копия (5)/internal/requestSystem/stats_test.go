@@ -0,0 +1,134 @@
+package requestsystem
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestStatsManager creates a statistics manager that logs to a temporary directory.
+func newTestStatsManager(t *testing.T, specialists int) *StatsManager {
+	t.Helper()
+	sm, err := NewStatsManager(filepath.Join(t.TempDir(), "stats.log"), specialists)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(sm.Close)
+	return sm
+}
+
+func TestAverageBufferTimeCountsServedRequests(t *testing.T) {
+	tests := []struct {
+		name   string
+		record func(sm *StatsManager, request *Request)
+	}{
+		{"rejected", (*StatsManager).RecordRejectedRequest},
+		{"abandoned", (*StatsManager).RecordAbandonedRequest},
+		{"balked", (*StatsManager).RecordBalkedRequest},
+		{"throttled", (*StatsManager).RecordThrottledRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sm := newTestStatsManager(t, 1)
+			client := &Client{ID: "1"}
+			served, lost := client.SubmitRequest("Test"), client.SubmitRequest("Test")
+			sm.RecordRequest(served)
+			sm.RecordRequest(lost)
+			tt.record(sm, lost)
+			sm.RecordBufferTime(served, 4*time.Millisecond)
+			sm.RecordProcessingTime(served, 6*time.Millisecond)
+
+			snapshot := sm.Snapshot()
+			if snapshot.AverageBufferTime != 4 {
+				t.Errorf("AverageBufferTime = %v ms, want 4", snapshot.AverageBufferTime)
+			}
+			if snapshot.AverageProcessingTime != 6 {
+				t.Errorf("AverageProcessingTime = %v ms, want 6", snapshot.AverageProcessingTime)
+			}
+		})
+	}
+}
+
+func TestJainIndex(t *testing.T) {
+	tests := []struct {
+		name   string
+		values []float64
+		want   float64
+	}{
+		{"no values", nil, 1},
+		{"only zeros", []float64{0, 0, 0}, 1},
+		{"single value", []float64{5}, 1},
+		{"equal values", []float64{3, 3, 3, 3}, 1},
+		{"one takes everything", []float64{0, 0, 0, 8}, 0.25},
+		{"two of four", []float64{1, 1, 0, 0}, 0.5},
+		{"uneven", []float64{1, 2, 3}, 36.0 / 42},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := JainIndex(tt.values); math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("JainIndex(%v) = %v, want %v", tt.values, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFlushKeepsEveryLogRow(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "stats.log")
+	sm, err := NewStatsManager(filename, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Строк больше, чем вмещает канал логов, и ни одна не теряется
+	const rows = 1000
+	createdAt := []time.Time{time.Now()}
+	for i := 0; i < rows-1; i++ {
+		sm.Flush(1, createdAt)
+	}
+	sm.RecordRequest(&Request{Client: &Client{ID: "1"}})
+	sm.Flush(1, createdAt)
+	sm.Close()
+
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != rows+1 {
+		t.Fatalf("log has %d rows, want a header and %d rows", len(lines), rows)
+	}
+	if fields := strings.Split(lines[rows], ","); fields[1] != "1" {
+		t.Errorf("last row %q has TotalRequests %s, want 1", lines[rows], fields[1])
+	}
+}
+
+func TestSampleHistoryIsBounded(t *testing.T) {
+	sm := newTestStatsManager(t, 0)
+	const points = 5*sampleHistorySize + 3
+	sm.mu.Lock()
+	for i := 0; i < points; i++ {
+		sm.addSample(StatsSample{TotalRequests: i})
+	}
+	sm.mu.Unlock()
+
+	samples, _ := sm.history()
+	if len(samples) > sampleHistorySize+1 {
+		t.Fatalf("history holds %d points, want at most %d", len(samples), sampleHistorySize+1)
+	}
+	if first := samples[0].TotalRequests; first != 0 {
+		t.Errorf("history starts at point %d, want 0", first)
+	}
+	if last := samples[len(samples)-1].TotalRequests; last != points-1 {
+		t.Errorf("history ends at point %d, want %d", last, points-1)
+	}
+	// Точки прорежены с одинаковым шагом
+	step := samples[1].TotalRequests - samples[0].TotalRequests
+	for i := 1; i < len(samples)-1; i++ {
+		if got := samples[i].TotalRequests - samples[i-1].TotalRequests; got != step {
+			t.Fatalf("step between points %d and %d is %d, want %d", i-1, i, got, step)
+		}
+	}
+}
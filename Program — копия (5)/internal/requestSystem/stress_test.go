@@ -0,0 +1,79 @@
+package requestsystem
+
+import (
+	"context"
+	"io"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestSimulationConcurrentReaders runs a short experiment with preemption, retrials and statistics windows
+// while other goroutines read the statistics and build the reports. Run it with -race.
+func TestSimulationConcurrentReaders(t *testing.T) {
+	if testing.Short() {
+		t.Skip("stress test")
+	}
+
+	service := map[int]DistributionConfig{
+		1: {Kind: DistributionExponential, Mean: Duration(2 * time.Millisecond)},
+		2: {Kind: DistributionExponential, Mean: Duration(3 * time.Millisecond)},
+	}
+	cfg := DefaultConfig()
+	cfg.ClientsNum = 4
+	cfg.BufferCap = 4
+	cfg.Duration1 = Duration(300 * time.Millisecond)
+	cfg.Duration2 = Duration(400 * time.Millisecond)
+	cfg.StatsWindow = Duration(50 * time.Millisecond)
+	cfg.Drain = true
+	cfg.Classes = []ClassConfig{
+		{Name: "Low", Arrival: &DistributionConfig{Kind: DistributionExponential, Mean: Duration(time.Millisecond)}, Service: service},
+		{Name: "High", Priority: 1, Arrival: &DistributionConfig{Kind: DistributionExponential, Mean: Duration(3 * time.Millisecond)}, Service: service},
+	}
+	cfg.Scheduling = &SchedulingConfig{Discipline: DisciplinePriority, Preemptive: true, Eviction: EvictLowestPriority}
+	cfg.Retrial = &RetrialConfig{Delay: DistributionConfig{Kind: DistributionConstant, Mean: Duration(5 * time.Millisecond)}, MaxRetries: 2}
+	sim := newTestSimulation(t, cfg)
+	sim.ReportManager.Out = io.Discard
+	dir := t.TempDir()
+
+	done := make(chan struct{})
+	var readers sync.WaitGroup
+	read := func(f func()) {
+		readers.Add(1)
+		go func() {
+			defer readers.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				f()
+				time.Sleep(time.Millisecond)
+			}
+		}()
+	}
+	read(func() { sim.StatsManager.Snapshot() })
+	read(func() {
+		sim.RetrievalManager.BufferedRequests()
+		sim.BusySpecialists()
+		sim.CollectMetrics(NewMetricsWriter(), Labels{"run": "1"})
+	})
+	read(func() { sim.GenerateReports(dir) })
+
+	sim.Run(context.Background())
+	close(done)
+	readers.Wait()
+	sim.GenerateReports(dir)
+
+	snapshot := sim.StatsManager.Snapshot()
+	if snapshot.TotalRequests == 0 {
+		t.Fatal("no requests were generated")
+	}
+	if snapshot.Preemptions == 0 {
+		t.Error("no request was preempted")
+	}
+	if got := sim.RetrievalManager.BufferedRequests() + sim.Orbit.Len() + sim.BusySpecialists(); got != 0 {
+		t.Errorf("%d requests are still in the system after Run", got)
+	}
+}
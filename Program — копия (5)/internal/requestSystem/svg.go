@@ -0,0 +1,160 @@
+package requestsystem
+
+import (
+	"fmt"
+	"html"
+	"math"
+	"strings"
+)
+
+const (
+	svgWidth       = 720
+	svgHeight      = 260
+	svgMarginLeft  = 60
+	svgMarginRight = 20
+	svgMarginTop   = 30
+	svgMarginBot   = 40
+)
+
+// svgPalette is the list of colors used for chart series.
+var svgPalette = []string{"#1f77b4", "#ff7f0e", "#2ca02c", "#d62728", "#9467bd", "#8c564b", "#e377c2", "#7f7f7f", "#bcbd22", "#17becf"}
+
+// svgSeries is a named line on a chart.
+type svgSeries struct {
+	Name string
+	X    []float64
+	Y    []float64
+}
+
+func svgColor(i int) string {
+	return svgPalette[i%len(svgPalette)]
+}
+
+// svgLineChart renders the series as an inline SVG line chart.
+func svgLineChart(title, xLabel, yLabel string, series []svgSeries) string {
+	minX, maxX := math.Inf(1), math.Inf(-1)
+	maxY := 0.0
+	for _, s := range series {
+		for i := range s.X {
+			minX = math.Min(minX, s.X[i])
+			maxX = math.Max(maxX, s.X[i])
+			maxY = math.Max(maxY, s.Y[i])
+		}
+	}
+	if math.IsInf(minX, 1) {
+		minX, maxX = 0, 1
+	}
+	if maxX == minX {
+		maxX = minX + 1
+	}
+	if maxY == 0 {
+		maxY = 1
+	}
+
+	plotW := float64(svgWidth - svgMarginLeft - svgMarginRight)
+	plotH := float64(svgHeight - svgMarginTop - svgMarginBot)
+	px := func(x float64) float64 { return svgMarginLeft + (x-minX)/(maxX-minX)*plotW }
+	py := func(y float64) float64 { return svgMarginTop + plotH - y/maxY*plotH }
+
+	var b strings.Builder
+	svgOpen(&b, title)
+	svgAxes(&b, xLabel, yLabel, minX, maxX, 0, maxY)
+
+	for i, s := range series {
+		if len(s.X) == 0 {
+			continue
+		}
+		points := make([]string, len(s.X))
+		for j := range s.X {
+			points[j] = fmt.Sprintf("%.1f,%.1f", px(s.X[j]), py(s.Y[j]))
+		}
+		fmt.Fprintf(&b, `<polyline fill="none" stroke="%s" stroke-width="1.5" points="%s"/>`+"\n", svgColor(i), strings.Join(points, " "))
+	}
+	svgLegend(&b, series)
+	b.WriteString("</svg>\n")
+	return b.String()
+}
+
+// svgHistogram renders the values as an inline SVG histogram with the given number of bins.
+func svgHistogram(title, xLabel string, values []float64, bins int) string {
+	maxX := 0.0
+	for _, v := range values {
+		maxX = math.Max(maxX, v)
+	}
+	if maxX == 0 {
+		maxX = 1
+	}
+
+	counts := make([]int, bins)
+	for _, v := range values {
+		i := int(v / maxX * float64(bins))
+		if i >= bins {
+			i = bins - 1
+		}
+		counts[i]++
+	}
+	maxCount := 1
+	for _, c := range counts {
+		if c > maxCount {
+			maxCount = c
+		}
+	}
+
+	plotW := float64(svgWidth - svgMarginLeft - svgMarginRight)
+	plotH := float64(svgHeight - svgMarginTop - svgMarginBot)
+	barW := plotW / float64(bins)
+
+	var b strings.Builder
+	svgOpen(&b, title)
+	svgAxes(&b, xLabel, "count", 0, maxX, 0, float64(maxCount))
+	for i, c := range counts {
+		h := float64(c) / float64(maxCount) * plotH
+		fmt.Fprintf(&b, `<rect x="%.1f" y="%.1f" width="%.1f" height="%.1f" fill="%s"><title>%d</title></rect>`+"\n",
+			svgMarginLeft+float64(i)*barW+1, svgMarginTop+plotH-h, math.Max(barW-2, 1), h, svgColor(0), c)
+	}
+	b.WriteString("</svg>\n")
+	return b.String()
+}
+
+func svgOpen(b *strings.Builder, title string) {
+	fmt.Fprintf(b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" font-family="sans-serif" font-size="11">`+"\n",
+		svgWidth, svgHeight, svgWidth, svgHeight)
+	fmt.Fprintf(b, `<text x="%d" y="18" font-size="14" font-weight="bold">%s</text>`+"\n", svgMarginLeft, html.EscapeString(title))
+}
+
+// svgAxes draws the plot frame with min/max tick labels on both axes.
+func svgAxes(b *strings.Builder, xLabel, yLabel string, minX, maxX, minY, maxY float64) {
+	left, top := svgMarginLeft, svgMarginTop
+	right, bottom := svgWidth-svgMarginRight, svgHeight-svgMarginBot
+
+	fmt.Fprintf(b, `<rect x="%d" y="%d" width="%d" height="%d" fill="none" stroke="#999"/>`+"\n", left, top, right-left, bottom-top)
+	for i := 0; i <= 4; i++ {
+		y := float64(bottom) - float64(i)/4*float64(bottom-top)
+		v := minY + float64(i)/4*(maxY-minY)
+		fmt.Fprintf(b, `<line x1="%d" y1="%.1f" x2="%d" y2="%.1f" stroke="#eee"/>`+"\n", left, y, right, y)
+		fmt.Fprintf(b, `<text x="%d" y="%.1f" text-anchor="end">%s</text>`+"\n", left-4, y+4, svgFormat(v))
+	}
+	fmt.Fprintf(b, `<text x="%d" y="%d">%s</text>`+"\n", left, bottom+14, svgFormat(minX))
+	fmt.Fprintf(b, `<text x="%d" y="%d" text-anchor="end">%s</text>`+"\n", right, bottom+14, svgFormat(maxX))
+	fmt.Fprintf(b, `<text x="%d" y="%d" text-anchor="middle">%s</text>`+"\n", (left+right)/2, bottom+30, html.EscapeString(xLabel))
+	fmt.Fprintf(b, `<text x="12" y="%d" text-anchor="middle" transform="rotate(-90 12 %d)">%s</text>`+"\n", (top+bottom)/2, (top+bottom)/2, html.EscapeString(yLabel))
+}
+
+func svgLegend(b *strings.Builder, series []svgSeries) {
+	if len(series) < 2 {
+		return
+	}
+	x := svgMarginLeft + 10
+	for i, s := range series {
+		y := svgMarginTop + 14 + i*14
+		fmt.Fprintf(b, `<rect x="%d" y="%d" width="10" height="10" fill="%s"/>`, x, y-9, svgColor(i))
+		fmt.Fprintf(b, `<text x="%d" y="%d">%s</text>`+"\n", x+14, y, html.EscapeString(s.Name))
+	}
+}
+
+func svgFormat(v float64) string {
+	if v == math.Trunc(v) && math.Abs(v) < 1e6 {
+		return fmt.Sprintf("%.0f", v)
+	}
+	return fmt.Sprintf("%.3g", v)
+}
@@ -0,0 +1,217 @@
+package requestsystem
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// BusyInterval is a period during which a specialist was processing a request.
+type BusyInterval struct {
+	SpecialistID int
+	RequestID    int
+	ClientID     string
+	Start        time.Time
+	End          time.Time
+}
+
+// Timeline records busy intervals of every specialist during a run.
+type Timeline struct {
+	Start         time.Time
+	specialistIDs []int
+	intervals     []BusyInterval
+	mu            sync.Mutex
+}
+
+// NewTimeline creates a timeline for the given specialists starting now.
+func NewTimeline(specialists []*Specialist) *Timeline {
+	ids := make([]int, len(specialists))
+	for i, s := range specialists {
+		ids[i] = s.Id
+	}
+	return &Timeline{
+		Start:         time.Now(),
+		specialistIDs: ids,
+	}
+}
+
+// Record adds a busy interval to the timeline.
+func (t *Timeline) Record(interval BusyInterval) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.intervals = append(t.intervals, interval)
+}
+
+// Intervals returns a copy of the recorded intervals sorted by start time.
+func (t *Timeline) Intervals() []BusyInterval {
+	t.mu.Lock()
+	intervals := make([]BusyInterval, len(t.intervals))
+	copy(intervals, t.intervals)
+	t.mu.Unlock()
+
+	sort.Slice(intervals, func(i, j int) bool {
+		return intervals[i].Start.Before(intervals[j].Start)
+	})
+	return intervals
+}
+
+// end returns the time of the latest recorded event, or now if nothing was recorded.
+func (t *Timeline) end(intervals []BusyInterval) time.Time {
+	end := t.Start
+	for _, in := range intervals {
+		if in.End.After(end) {
+			end = in.End
+		}
+	}
+	if end.Equal(t.Start) {
+		end = time.Now()
+	}
+	return end
+}
+
+// busyTime returns the total busy time of every specialist.
+func (t *Timeline) busyTime(intervals []BusyInterval) map[int]time.Duration {
+	busy := make(map[int]time.Duration)
+	for _, in := range intervals {
+		busy[in.SpecialistID] += in.End.Sub(in.Start)
+	}
+	return busy
+}
+
+// WriteSVG writes the timeline as an SVG Gantt chart, one row per specialist.
+func (t *Timeline) WriteSVG(w io.Writer) error {
+	intervals := t.Intervals()
+	end := t.end(intervals)
+	total := end.Sub(t.Start).Seconds()
+
+	const rowHeight = 24
+	left, right, top := 110, 20, 30
+	width := 960
+	height := top + rowHeight*len(t.specialistIDs) + 30
+	plotW := float64(width - left - right)
+	px := func(tm time.Time) float64 { return float64(left) + tm.Sub(t.Start).Seconds()/total*plotW }
+
+	rows := make(map[int]int)
+	for i, id := range t.specialistIDs {
+		rows[id] = i
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" font-family="sans-serif" font-size="11">`+"\n", width, height, width, height)
+	fmt.Fprintf(&b, `<text x="%d" y="18" font-size="14" font-weight="bold">Specialist timeline</text>`+"\n", left)
+
+	busy := t.busyTime(intervals)
+	for i, id := range t.specialistIDs {
+		y := top + i*rowHeight
+		fmt.Fprintf(&b, `<rect x="%d" y="%d" width="%.1f" height="%d" fill="#f4f4f4"/>`+"\n", left, y+2, plotW, rowHeight-4)
+		fmt.Fprintf(&b, `<text x="4" y="%d">Specialist %d (%.0f%%)</text>`+"\n", y+rowHeight/2+4, id, busy[id].Seconds()/total*100)
+	}
+
+	for _, in := range intervals {
+		row, ok := rows[in.SpecialistID]
+		if !ok {
+			continue
+		}
+		y := top + row*rowHeight
+		x := px(in.Start)
+		fmt.Fprintf(&b, `<rect x="%.2f" y="%d" width="%.2f" height="%d" fill="%s" stroke="#fff" stroke-width="0.5"><title>%s</title></rect>`+"\n",
+			x, y+2, px(in.End)-x, rowHeight-4, svgColor(in.RequestID),
+			html.EscapeString(fmt.Sprintf("Request %d, client %s: %.3fs - %.3fs", in.RequestID, in.ClientID,
+				in.Start.Sub(t.Start).Seconds(), in.End.Sub(t.Start).Seconds())))
+	}
+
+	axisY := top + rowHeight*len(t.specialistIDs) + 14
+	fmt.Fprintf(&b, `<text x="%d" y="%d">0s</text>`+"\n", left, axisY)
+	fmt.Fprintf(&b, `<text x="%d" y="%d" text-anchor="end">%.1fs</text>`+"\n", width-right, axisY, total)
+	b.WriteString("</svg>\n")
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// ASCII returns the timeline as text with the given number of columns per row.
+// A cell is '#' when the specialist was busy during that slice of time and '.' otherwise.
+func (t *Timeline) ASCII(width int) string {
+	intervals := t.Intervals()
+	end := t.end(intervals)
+	total := end.Sub(t.Start)
+	slot := total / time.Duration(width)
+	if slot <= 0 {
+		slot = 1
+	}
+
+	rows := make(map[int][]byte)
+	for _, id := range t.specialistIDs {
+		rows[id] = []byte(strings.Repeat(".", width))
+	}
+	for _, in := range intervals {
+		row, ok := rows[in.SpecialistID]
+		if !ok {
+			continue
+		}
+		from := int(in.Start.Sub(t.Start) / slot)
+		to := int(in.End.Sub(t.Start) / slot)
+		for i := from; i <= to && i < width; i++ {
+			row[i] = '#'
+		}
+	}
+
+	busy := t.busyTime(intervals)
+	var b strings.Builder
+	fmt.Fprintf(&b, "Specialist timeline: %s, one column = %s\n", total, slot)
+	for _, id := range t.specialistIDs {
+		fmt.Fprintf(&b, "%-4d |%s| busy %-14s idle %s\n", id, rows[id], busy[id], total-busy[id])
+	}
+	return b.String()
+}
+
+// traceEvent is an event of the Chrome/Perfetto trace-event JSON format.
+type traceEvent struct {
+	Name      string                 `json:"name"`
+	Category  string                 `json:"cat,omitempty"`
+	Phase     string                 `json:"ph"`
+	Timestamp int64                  `json:"ts"`
+	Duration  int64                  `json:"dur,omitempty"`
+	PID       int                    `json:"pid"`
+	TID       int                    `json:"tid"`
+	Args      map[string]interface{} `json:"args,omitempty"`
+}
+
+// WriteTraceEvents writes the timeline in the trace-event JSON format understood by
+// chrome://tracing and ui.perfetto.dev. Every specialist is shown as a separate thread.
+func (t *Timeline) WriteTraceEvents(w io.Writer) error {
+	intervals := t.Intervals()
+	events := make([]traceEvent, 0, len(intervals)+len(t.specialistIDs))
+
+	for _, id := range t.specialistIDs {
+		events = append(events, traceEvent{
+			Name:  "thread_name",
+			Phase: "M",
+			PID:   1,
+			TID:   id,
+			Args:  map[string]interface{}{"name": fmt.Sprintf("Specialist %d", id)},
+		})
+	}
+	for _, in := range intervals {
+		events = append(events, traceEvent{
+			Name:      fmt.Sprintf("Request %d", in.RequestID),
+			Category:  "request",
+			Phase:     "X",
+			Timestamp: in.Start.Sub(t.Start).Microseconds(),
+			Duration:  in.End.Sub(in.Start).Microseconds(),
+			PID:       1,
+			TID:       in.SpecialistID,
+			Args:      map[string]interface{}{"request": in.RequestID, "client": in.ClientID},
+		})
+	}
+
+	return json.NewEncoder(w).Encode(map[string]interface{}{
+		"traceEvents":     events,
+		"displayTimeUnit": "ms",
+	})
+}
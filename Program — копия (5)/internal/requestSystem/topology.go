@@ -0,0 +1,244 @@
+package requestsystem
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Топологии буферов
+const (
+	TopologyShared      = "shared"      // Один буфер для всех заявок
+	TopologyClient      = "client"      // Свой буфер у каждого клиента
+	TopologyClass       = "class"       // Свой буфер у каждого класса заявок
+	TopologyPartitioned = "partitioned" // Гарантированные места каждого клиента и общая область переполнения
+)
+
+// Политики выбора буфера, из которого берется следующая заявка
+const (
+	SelectPriority   = "priority"    // Сначала буферы с большим приоритетом
+	SelectRoundRobin = "round_robin" // Буферы по кругу
+	SelectWeighted   = "weighted"    // Буферы по кругу пропорционально весам
+)
+
+// SharedQueue is the name of the shared overflow region of the partitioned topology.
+const SharedQueue = "shared"
+
+// Queue is one of the buffers of a topology.
+type Queue struct {
+	Name     string // ID клиента, имя класса или SharedQueue
+	Buffer   *Buffer
+	Priority int // priority: чем больше, тем раньше из буфера берутся заявки
+	Weight   int // weighted: доля выборов буфера
+
+	credit int // weighted: накопленный вес плавного взвешенного кругового выбора
+}
+
+// Topology divides the waiting requests into several buffers and chooses the buffer
+// the next request is taken from.
+// Place may be called concurrently; Order and Taken must be called by one dispatcher at a time.
+type Topology struct {
+	Kind      string
+	Selection string
+	Queues    []*Queue
+	Shared    *Queue // partitioned: общая область, куда попадают заявки из заполненных разделов
+
+	byKey      map[string]*Queue // Буфер по ID клиента или имени класса
+	next       int               // round_robin: буфер, с которого начинается следующий выбор
+	candidates []*Queue          // weighted: непустые буферы последнего выбора
+}
+
+// Place returns the queue the request waits in and whether it spilled over to the shared region
+// because its partition is full. A request without its own queue waits in the shared region or,
+// without one, in the first queue.
+func (t *Topology) Place(request *Request) (*Queue, bool) {
+	key := request.Client.ID
+	if t.Kind == TopologyClass {
+		key = request.ClassName()
+	}
+	queue, ok := t.byKey[key]
+	switch {
+	case !ok && t.Shared != nil:
+		return t.Shared, false
+	case !ok:
+		return t.Queues[0], false
+	case t.Shared != nil && queue.Buffer.IsFull():
+		// Гарантированные места клиента заняты
+		return t.Shared, true
+	}
+	return queue, false
+}
+
+// Order returns the non-empty queues in the order they are tried for the next request.
+func (t *Topology) Order() []*Queue {
+	var queues []*Queue
+	switch t.Selection {
+	case SelectRoundRobin:
+		for i := range t.Queues {
+			if queue := t.Queues[(t.next+i)%len(t.Queues)]; !queue.Buffer.IsEmpty() {
+				queues = append(queues, queue)
+			}
+		}
+	default:
+		for _, queue := range t.Queues {
+			if !queue.Buffer.IsEmpty() {
+				queues = append(queues, queue)
+			}
+		}
+	}
+
+	switch t.Selection {
+	case SelectPriority:
+		sort.SliceStable(queues, func(i, j int) bool {
+			return queues[i].Priority > queues[j].Priority
+		})
+	case SelectWeighted:
+		// Плавный взвешенный круговой выбор: первым идет буфер с наибольшим накопленным весом
+		t.candidates = queues
+		queues = append([]*Queue(nil), queues...)
+		sort.SliceStable(queues, func(i, j int) bool {
+			return queues[i].credit+queues[i].Weight > queues[j].credit+queues[j].Weight
+		})
+	}
+	return queues
+}
+
+// Taken tells the topology that the next request was taken from the queue returned by the last Order.
+func (t *Topology) Taken(queue *Queue) {
+	switch t.Selection {
+	case SelectRoundRobin:
+		for i, q := range t.Queues {
+			if q == queue {
+				t.next = (i + 1) % len(t.Queues)
+			}
+		}
+	case SelectWeighted:
+		total := 0
+		for _, q := range t.candidates {
+			q.credit += q.Weight
+			total += q.Weight
+		}
+		queue.credit -= total
+	}
+}
+
+// Buffers returns the buffers of all queues.
+func (t *Topology) Buffers() []*Buffer {
+	buffers := make([]*Buffer, 0, len(t.Queues))
+	for _, queue := range t.Queues {
+		buffers = append(buffers, queue.Buffer)
+	}
+	return buffers
+}
+
+// TopologyConfig describes the buffer topology in the experiment config.
+type TopologyConfig struct {
+	Kind      string `json:"kind"`                // shared, client, class, partitioned
+	Selection string `json:"selection,omitempty"` // priority, round_robin, weighted; по умолчанию round_robin
+
+	// Емкость буфера клиента или класса, для partitioned - число гарантированных мест клиента.
+	// По умолчанию buffer_cap; общая область partitioned всегда имеет емкость buffer_cap
+	Capacity   int            `json:"capacity,omitempty"`
+	Capacities map[string]int `json:"capacities,omitempty"` // По ID клиента или имени класса
+
+	// По ID клиента, имени класса или "shared". Приоритет буфера класса по умолчанию - приоритет класса, вес - 1
+	Priorities map[string]int `json:"priorities,omitempty"`
+	Weights    map[string]int `json:"weights,omitempty"`
+}
+
+// Topology creates the topology described by the config for the clients and the classes.
+// The shared buffer becomes the overflow region of the partitioned topology.
+// For the shared topology it returns nil: all requests wait in the shared buffer.
+func (tc TopologyConfig) Topology(clients []*Client, classes []*RequestClass, shared *Buffer) (*Topology, error) {
+	switch tc.Selection {
+	case "", SelectPriority, SelectRoundRobin, SelectWeighted:
+	default:
+		return nil, fmt.Errorf("unknown selection policy %q", tc.Selection)
+	}
+	if tc.Capacity < 0 {
+		return nil, fmt.Errorf("capacity must not be negative")
+	}
+
+	t := &Topology{Kind: tc.Kind, Selection: tc.Selection, byKey: make(map[string]*Queue)}
+	if t.Selection == "" {
+		t.Selection = SelectRoundRobin
+	}
+	defaultCapacity := tc.Capacity
+	if defaultCapacity == 0 {
+		defaultCapacity = shared.Capacity
+	}
+
+	var keys []string
+	priorities := make(map[string]int)
+	switch tc.Kind {
+	case "", TopologyShared:
+		return nil, nil
+	case TopologyClient, TopologyPartitioned:
+		for _, client := range clients {
+			keys = append(keys, client.ID)
+		}
+	case TopologyClass:
+		if len(classes) == 0 {
+			return nil, fmt.Errorf("the %q topology requires request classes", TopologyClass)
+		}
+		for _, class := range classes {
+			keys = append(keys, class.Name)
+			priorities[class.Name] = class.Priority
+		}
+	default:
+		return nil, fmt.Errorf("unknown topology %q", tc.Kind)
+	}
+
+	known := make(map[string]bool, len(keys)+1)
+	for _, key := range keys {
+		known[key] = true
+	}
+	if tc.Kind == TopologyPartitioned {
+		known[SharedQueue] = true
+	}
+	for key, capacity := range tc.Capacities {
+		switch {
+		case !known[key] || key == SharedQueue:
+			return nil, fmt.Errorf("capacities: unknown queue %q", key)
+		case capacity <= 0:
+			return nil, fmt.Errorf("capacities: queue %q: capacity must be positive", key)
+		}
+	}
+	for key := range tc.Priorities {
+		if !known[key] {
+			return nil, fmt.Errorf("priorities: unknown queue %q", key)
+		}
+	}
+	for key, weight := range tc.Weights {
+		switch {
+		case !known[key]:
+			return nil, fmt.Errorf("weights: unknown queue %q", key)
+		case weight <= 0:
+			return nil, fmt.Errorf("weights: queue %q: weight must be positive", key)
+		}
+	}
+
+	newQueue := func(name string, buffer *Buffer) *Queue {
+		queue := &Queue{Name: name, Buffer: buffer, Priority: priorities[name], Weight: 1}
+		if priority, ok := tc.Priorities[name]; ok {
+			queue.Priority = priority
+		}
+		if weight, ok := tc.Weights[name]; ok {
+			queue.Weight = weight
+		}
+		return queue
+	}
+	for _, key := range keys {
+		capacity := defaultCapacity
+		if c, ok := tc.Capacities[key]; ok {
+			capacity = c
+		}
+		queue := newQueue(key, NewBuffer(capacity))
+		t.Queues = append(t.Queues, queue)
+		t.byKey[key] = queue
+	}
+	if tc.Kind == TopologyPartitioned {
+		t.Shared = newQueue(SharedQueue, shared)
+		t.Queues = append(t.Queues, t.Shared)
+	}
+	return t, nil
+}
@@ -0,0 +1,161 @@
+package requestsystem
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// WorkerPoolConfig describes a pool of specialists that execute a real handler.
+type WorkerPoolConfig struct {
+	Workers   int
+	BufferCap int
+	Handler   Handler
+	Timeout   time.Duration // Ограничение времени работы обработчика, 0 - без ограничения
+	StatsFile string
+
+	// При остановке дообработать заявки из буфера и у специалистов в течение DrainTimeout
+	Drain        bool
+	DrainTimeout time.Duration
+
+	// Записывать интервалы занятости специалистов в RetrievalManager.Timeline. Интервалы хранятся
+	// до закрытия пула, поэтому долго работающему сервису таймлайн лучше не включать
+	Timeline bool
+}
+
+// WorkerPool dispatches real jobs with the same Buffer, StagingManager and RetrievalManager
+// policies as the simulation. Specialists run the handler instead of sleeping.
+type WorkerPool struct {
+	Buffer           *Buffer
+	Specialists      []*Specialist
+	CreatedAtTimes   []time.Time
+	StagingManager   *StagingManager
+	RetrievalManager *RetrievalManager
+	StatsManager     *StatsManager
+	ReportManager    *ReportManager
+	Events           *EventBus
+	OnReject         func(request *Request) // Вызывается для заявки, вытесненной из буфера, не вставшей в очередь или не дождавшейся обработки
+
+	drain        bool
+	drainTimeout time.Duration
+	cancel       context.CancelFunc
+	stopLogging  context.CancelFunc
+	loggerDone   chan struct{}
+	wg           sync.WaitGroup
+}
+
+// NewWorkerPool creates the specialists, buffer and managers of the pool.
+func NewWorkerPool(cfg WorkerPoolConfig) (*WorkerPool, error) {
+	if cfg.Workers <= 0 {
+		return nil, fmt.Errorf("at least one worker is required")
+	}
+	if cfg.BufferCap <= 0 {
+		return nil, fmt.Errorf("buffer capacity must be positive")
+	}
+	if cfg.Handler == nil {
+		return nil, fmt.Errorf("handler is required")
+	}
+	if cfg.StatsFile == "" {
+		return nil, fmt.Errorf("stats file is required")
+	}
+
+	statsManager, err := NewStatsManager(cfg.StatsFile, cfg.Workers)
+	if err != nil {
+		return nil, err
+	}
+
+	wp := &WorkerPool{
+		Buffer:        NewBuffer(cfg.BufferCap),
+		StatsManager:  statsManager,
+		ReportManager: NewReportManager(statsManager),
+		Events:        NewEventBus(),
+		drain:         cfg.Drain,
+		drainTimeout:  cfg.DrainTimeout,
+	}
+	for i := 1; i <= cfg.Workers; i++ {
+		specialist := NewSpecialist(i, 0, wp.Events)
+		specialist.Handler = cfg.Handler
+		specialist.Timeout = cfg.Timeout
+		wp.Specialists = append(wp.Specialists, specialist)
+		wp.CreatedAtTimes = append(wp.CreatedAtTimes, specialist.CreatedAt)
+	}
+
+	wp.RetrievalManager = &RetrievalManager{
+		Buffer:       wp.Buffer,
+		Specialists:  wp.Specialists,
+		Events:       wp.Events,
+		StatsManager: statsManager,
+	}
+	if cfg.Timeline {
+		wp.RetrievalManager.Timeline = NewTimeline(wp.Specialists)
+	}
+	wp.StagingManager = &StagingManager{Buffer: wp.Buffer, Events: wp.Events, StatsManager: statsManager}
+	wp.StagingManager.OnAbandon = func(request *Request) {
+		if wp.OnReject != nil {
+			wp.OnReject(request)
+		}
+	}
+
+	return wp, nil
+}
+
+// Start runs the processing loop and the statistics logger until Stop is called or ctx is cancelled.
+func (wp *WorkerPool) Start(ctx context.Context) {
+	ctx, wp.cancel = context.WithCancel(ctx)
+
+	wp.wg.Add(1)
+	StartRequestProcessing(ctx, wp.RetrievalManager, &wp.wg, 0)
+
+	wp.loggerDone = make(chan struct{})
+	logCtx, stopLogging := context.WithCancel(context.Background())
+	wp.stopLogging = stopLogging
+	go func() {
+		defer close(wp.loggerDone)
+		RunStatsLogger(logCtx, wp.StatsManager, wp.Buffer.Len, wp.CreatedAtTimes, wp.Events)
+	}()
+}
+
+// Submit creates a request of the client with the payload and places it in the pool.
+// A request displaced from the full buffer or balked by its client is passed to OnReject.
+func (wp *WorkerPool) Submit(client *Client, payload interface{}) *Request {
+	request := client.SubmitRequest("Job")
+	request.Payload = payload
+
+	if dropped := PlaceRequest(request, wp.StagingManager, wp.RetrievalManager, wp.StatsManager); dropped != nil && wp.OnReject != nil {
+		wp.OnReject(dropped)
+	}
+	return request
+}
+
+// Stop stops accepting new work and, with Drain, processes the buffered requests within DrainTimeout.
+// Then it interrupts the requests still in progress, waits for the specialists and flushes the statistics.
+// Requests left in the buffer are not processed: they are recorded as rejected and passed to OnReject.
+func (wp *WorkerPool) Stop() {
+	wp.cancel()
+	wp.wg.Wait()
+
+	if wp.drain {
+		drainCtx, cancel := context.WithTimeout(context.Background(), wp.drainTimeout)
+		wp.RetrievalManager.Drain(drainCtx)
+		cancel()
+	}
+	wp.RetrievalManager.CancelWork()
+
+	for request := wp.Buffer.GetNextRequest(); request != nil; request = wp.Buffer.GetNextRequest() {
+		wp.StatsManager.RecordRejectedRequest(request)
+		if wp.OnReject != nil {
+			wp.OnReject(request)
+		}
+	}
+	wp.RetrievalManager.WaitForAllRequests()
+
+	wp.stopLogging()
+	<-wp.loggerDone
+	wp.StatsManager.Flush(len(wp.Specialists), wp.CreatedAtTimes)
+}
+
+// Close releases the files held by the pool.
+func (wp *WorkerPool) Close() {
+	wp.StatsManager.Close()
+}
@@ -0,0 +1,34 @@
+package requestsystem
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+)
+
+func TestWorkerPoolTimeline(t *testing.T) {
+	for _, enabled := range []bool{false, true} {
+		pool, err := NewWorkerPool(WorkerPoolConfig{
+			Workers:   1,
+			BufferCap: 1,
+			Handler:   func(ctx context.Context, request *Request) error { return nil },
+			StatsFile: filepath.Join(t.TempDir(), "stats.log"),
+			Timeline:  enabled,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		pool.Start(context.Background())
+		<-pool.Submit(&Client{ID: "1"}, nil).Done()
+		pool.Stop()
+		pool.Close()
+
+		timeline := pool.RetrievalManager.Timeline
+		if (timeline != nil) != enabled {
+			t.Fatalf("Timeline = %v with Timeline: %v", timeline, enabled)
+		}
+		if enabled && len(timeline.Intervals()) != 1 {
+			t.Errorf("timeline holds %d intervals, want 1", len(timeline.Intervals()))
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	requestsystem "program/internal/requestSystem"
+	"strconv"
+	"time"
+)
+
+const (
+	subscriberBufferSize = 256              // Сколько событий может накопить медленный подписчик
+	keepAliveInterval    = 15 * time.Second // Период комментариев, поддерживающих соединение
+)
+
+// handleEvents streams the events of a run as Server-Sent Events.
+// The stream can be filtered with the client and specialist query parameters.
+// When the subscriber falls behind, events are dropped and a "dropped" event reports how many.
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	run, ok := s.lookup(r.PathValue("id"))
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Errorf("run %s not found", r.PathValue("id")))
+		return
+	}
+
+	filter := requestsystem.EventFilter{ClientID: r.URL.Query().Get("client")}
+	if specialist := r.URL.Query().Get("specialist"); specialist != "" {
+		id, err := strconv.Atoi(specialist)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid specialist: %w", err))
+			return
+		}
+		filter.SpecialistID = id
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, fmt.Errorf("streaming is not supported"))
+		return
+	}
+
+	sub := run.sim.Events.Subscribe(filter, subscriberBufferSize)
+	defer run.sim.Events.Unsubscribe(sub)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(keepAliveInterval)
+	defer keepAlive.Stop()
+
+	var reportedDropped int64
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-run.done:
+			writeEvent(w, "end", s.status(run))
+			flusher.Flush()
+			return
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+		case event := <-sub.C:
+			if dropped := sub.Dropped(); dropped != reportedDropped {
+				writeEvent(w, "dropped", map[string]int64{"dropped": dropped})
+				reportedDropped = dropped
+			}
+			writeEvent(w, event.Type, event)
+		}
+		flusher.Flush()
+	}
+}
+
+// writeEvent writes a single SSE message with a JSON payload.
+func writeEvent(w http.ResponseWriter, eventType string, v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		fmt.Println("Error encoding event:", err)
+		return
+	}
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", eventType, data)
+}
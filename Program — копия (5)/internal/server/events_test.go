@@ -0,0 +1,140 @@
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	requestsystem "program/internal/requestSystem"
+	"strings"
+	"testing"
+	"time"
+)
+
+// sseFrame is a single Server-Sent Events message.
+type sseFrame struct {
+	event string
+	data  string
+}
+
+// readFrame reads the next message of the stream, skipping keep-alive comments.
+func readFrame(t *testing.T, r *bufio.Reader) sseFrame {
+	t.Helper()
+	var frame sseFrame
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("stream ended: %v", err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case line == "":
+			if frame.event != "" {
+				return frame
+			}
+		case strings.HasPrefix(line, "event: "):
+			frame.event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			frame.data = strings.TrimPrefix(line, "data: ")
+		}
+	}
+}
+
+// subscribe starts a long run that generates no requests of its own and opens its event stream.
+// The subscription is registered once the response headers arrive.
+func subscribe(t *testing.T, query string) (*Run, *http.Response) {
+	t.Helper()
+	s, ts := newTestServer(t, t.TempDir())
+	cfg := requestsystem.DefaultConfig()
+	cfg.Lamb = 1e9 // Клиенты не успевают создать ни одной заявки
+	cfg.Duration1 = requestsystem.Duration(time.Hour)
+	cfg.Duration2 = requestsystem.Duration(time.Hour)
+	run, err := s.Start(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := http.Get(ts.URL + "/runs/" + run.ID + "/events" + query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("GET events = %d %q, want 200 text/event-stream", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	return run, resp
+}
+
+// publish publishes an event about a request of the client.
+func publish(run *Run, eventType, clientID string) {
+	run.sim.Events.Publish(requestsystem.Event{Type: eventType, Time: time.Now(), ClientID: clientID})
+}
+
+func TestEventsFilter(t *testing.T) {
+	run, resp := subscribe(t, "?client=a")
+	publish(run, requestsystem.EventArrival, "b")
+	publish(run, requestsystem.EventArrival, "a")
+	publish(run, requestsystem.EventCompleted, "b")
+	publish(run, requestsystem.EventCompleted, "a")
+
+	r := bufio.NewReader(resp.Body)
+	var got []string
+	for len(got) < 2 {
+		frame := readFrame(t, r)
+		if frame.event == requestsystem.EventStats {
+			continue
+		}
+		var event requestsystem.Event
+		if err := json.Unmarshal([]byte(frame.data), &event); err != nil {
+			t.Fatalf("bad data %q: %v", frame.data, err)
+		}
+		if event.ClientID != "a" || event.Type != frame.event {
+			t.Errorf("got %q event %+v, want an event of client a", frame.event, event)
+		}
+		got = append(got, frame.event)
+	}
+	if want := []string{requestsystem.EventArrival, requestsystem.EventCompleted}; strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("got events %v, want %v", got, want)
+	}
+}
+
+func TestEventsDropForSlowSubscriber(t *testing.T) {
+	run, resp := subscribe(t, "")
+
+	// Подписчик не читает поток, а публикация все равно не блокируется
+	const events = 100 * subscriberBufferSize
+	published := make(chan struct{})
+	go func() {
+		defer close(published)
+		for i := 0; i < events; i++ {
+			publish(run, requestsystem.EventArrival, "a")
+		}
+	}()
+	select {
+	case <-published:
+	case <-time.After(10 * time.Second):
+		t.Fatal("publishing blocked on a slow subscriber")
+	}
+	// Следующее событие сообщает, сколько потеряно до него
+	publish(run, requestsystem.EventCompleted, "a")
+
+	r := bufio.NewReader(resp.Body)
+	received := 0
+	for {
+		frame := readFrame(t, r)
+		switch frame.event {
+		case requestsystem.EventArrival:
+			received++
+		case "dropped":
+			var body map[string]int64
+			if err := json.Unmarshal([]byte(frame.data), &body); err != nil {
+				t.Fatalf("bad data %q: %v", frame.data, err)
+			}
+			if body["dropped"] <= 0 || body["dropped"] > events {
+				t.Errorf("dropped = %d, want between 1 and %d", body["dropped"], events)
+			}
+			return
+		case requestsystem.EventCompleted:
+			t.Fatalf("stream received %d of %d events without reporting drops", received, events)
+		}
+	}
+}
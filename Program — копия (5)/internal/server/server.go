@@ -0,0 +1,308 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	requestsystem "program/internal/requestSystem"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Статусы эксперимента
+const (
+	StatusRunning   = "running"
+	StatusCompleted = "completed"
+	StatusCancelled = "cancelled"
+)
+
+// Run is a single experiment started through the API.
+type Run struct {
+	ID         string
+	Config     requestsystem.Config
+	Status     string
+	StartedAt  time.Time
+	FinishedAt time.Time
+	Dir        string
+
+	sim    *requestsystem.Simulation
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// RunStatus is the JSON representation of a run.
+type RunStatus struct {
+	ID              string                       `json:"id"`
+	Status          string                       `json:"status"`
+	Config          requestsystem.Config         `json:"config"`
+	StartedAt       time.Time                    `json:"started_at"`
+	FinishedAt      *time.Time                   `json:"finished_at,omitempty"`
+	Dir             string                       `json:"dir"`
+	BufferOccupancy int                          `json:"buffer_occupancy"`
+	BusySpecialists int                          `json:"busy_specialists"`
+	Stats           *requestsystem.StatsSnapshot `json:"stats,omitempty"`
+}
+
+// Server runs experiments on request and reports their progress over HTTP.
+type Server struct {
+	Dir    string // Каталог, в котором создаются файлы экспериментов
+	runs   map[string]*Run
+	nextID int
+	mu     sync.Mutex
+}
+
+// New creates a server that stores the output of every run in a subdirectory of dir.
+func New(dir string) *Server {
+	return &Server{
+		Dir:  dir,
+		runs: make(map[string]*Run),
+	}
+}
+
+// Handler returns the HTTP handler with the API routes.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /runs", s.handleStart)
+	mux.HandleFunc("GET /runs", s.handleList)
+	mux.HandleFunc("GET /runs/{id}", s.handleStatus)
+	mux.HandleFunc("DELETE /runs/{id}", s.handleCancel)
+	mux.HandleFunc("GET /runs/{id}/events", s.handleEvents)
+	mux.HandleFunc("GET /metrics", s.handleMetrics)
+	return mux
+}
+
+// ErrInvalidConfig is returned by Start for a config that does not describe a runnable experiment.
+var ErrInvalidConfig = errors.New("invalid config")
+
+// Start creates and starts a run with the given config.
+// A config error wraps ErrInvalidConfig; other errors come from creating the files of the run.
+func (s *Server) Start(cfg requestsystem.Config) (*Run, error) {
+	s.mu.Lock()
+	s.nextID++
+	id := strconv.Itoa(s.nextID)
+	s.mu.Unlock()
+
+	// Каталог создается только для правильной конфигурации
+	dir := filepath.Join(s.Dir, id)
+	cfg.StatsFile = filepath.Join(dir, "stats.log")
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidConfig, err)
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	sim, err := requestsystem.NewSimulation(cfg)
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	// Вывод параллельных экспериментов не перемешивается: отчет пишется в каталог эксперимента,
+	// ошибки - в журнал с номером эксперимента
+	sim.Logger = log.New(os.Stderr, "run "+id+": ", log.LstdFlags)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	run := &Run{
+		ID:        id,
+		Config:    cfg,
+		Status:    StatusRunning,
+		StartedAt: time.Now(),
+		Dir:       dir,
+		sim:       sim,
+		cancel:    cancel,
+		done:      make(chan struct{}),
+	}
+
+	s.mu.Lock()
+	s.runs[id] = run
+	s.mu.Unlock()
+
+	go func() {
+		defer close(run.done)
+		defer cancel()
+
+		sim.Run(ctx)
+		s.writeReports(sim, dir)
+		sim.Close()
+
+		s.mu.Lock()
+		if run.Status == StatusRunning {
+			run.Status = StatusCompleted
+		}
+		run.FinishedAt = time.Now()
+		s.mu.Unlock()
+	}()
+
+	return run, nil
+}
+
+// writeReports writes the text report of the finished run into report.txt next to the other reports.
+func (s *Server) writeReports(sim *requestsystem.Simulation, dir string) {
+	file, err := os.Create(filepath.Join(dir, "report.txt"))
+	if err != nil {
+		// HTML-отчет и таймлайны все равно сохраняются
+		sim.Logger.Printf("Error creating text report: %v", err)
+		sim.ReportManager.Out = io.Discard
+	} else {
+		defer file.Close()
+		sim.ReportManager.Out = file
+	}
+	sim.GenerateReports(dir)
+}
+
+// Cancel stops the run with the given id and waits until it finishes.
+func (s *Server) Cancel(id string) (*Run, bool) {
+	s.mu.Lock()
+	run, ok := s.runs[id]
+	if ok && run.Status == StatusRunning {
+		run.Status = StatusCancelled
+	}
+	s.mu.Unlock()
+	if !ok {
+		return nil, false
+	}
+
+	run.cancel()
+	<-run.done
+	return run, true
+}
+
+// Shutdown cancels all running experiments.
+func (s *Server) Shutdown() {
+	s.mu.Lock()
+	ids := make([]string, 0, len(s.runs))
+	for id := range s.runs {
+		ids = append(ids, id)
+	}
+	s.mu.Unlock()
+
+	for _, id := range ids {
+		s.Cancel(id)
+	}
+}
+
+// status builds the JSON representation of the run.
+func (s *Server) status(run *Run) RunStatus {
+	s.mu.Lock()
+	st := RunStatus{
+		ID:        run.ID,
+		Status:    run.Status,
+		Config:    run.Config,
+		StartedAt: run.StartedAt,
+		Dir:       run.Dir,
+	}
+	if !run.FinishedAt.IsZero() {
+		finishedAt := run.FinishedAt
+		st.FinishedAt = &finishedAt
+	}
+	s.mu.Unlock()
+
+	snapshot := run.sim.StatsManager.Snapshot()
+	st.Stats = &snapshot
+	st.BufferOccupancy = run.sim.RetrievalManager.BufferedRequests()
+	st.BusySpecialists = run.sim.BusySpecialists()
+	return st
+}
+
+// sortedRuns returns all runs in the order they were started.
+func (s *Server) sortedRuns() []*Run {
+	s.mu.Lock()
+	runs := make([]*Run, 0, len(s.runs))
+	for _, run := range s.runs {
+		runs = append(runs, run)
+	}
+	s.mu.Unlock()
+
+	sort.Slice(runs, func(i, j int) bool { return runs[i].StartedAt.Before(runs[j].StartedAt) })
+	return runs
+}
+
+func (s *Server) lookup(id string) (*Run, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	run, ok := s.runs[id]
+	return run, ok
+}
+
+// handleStart decodes the config and starts a new run. Missing fields keep their default values.
+func (s *Server) handleStart(w http.ResponseWriter, r *http.Request) {
+	cfg := requestsystem.DefaultConfig()
+	if err := json.NewDecoder(r.Body).Decode(&cfg); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid config: %w", err))
+		return
+	}
+
+	run, err := s.Start(cfg)
+	if errors.Is(err, ErrInvalidConfig) {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.Header().Set("Location", "/runs/"+run.ID)
+	writeJSON(w, http.StatusCreated, s.status(run))
+}
+
+func (s *Server) handleList(w http.ResponseWriter, r *http.Request) {
+	runs := s.sortedRuns()
+	statuses := make([]RunStatus, len(runs))
+	for i, run := range runs {
+		statuses[i] = s.status(run)
+	}
+	writeJSON(w, http.StatusOK, statuses)
+}
+
+func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
+	run, ok := s.lookup(r.PathValue("id"))
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Errorf("run %s not found", r.PathValue("id")))
+		return
+	}
+	writeJSON(w, http.StatusOK, s.status(run))
+}
+
+func (s *Server) handleCancel(w http.ResponseWriter, r *http.Request) {
+	run, ok := s.Cancel(r.PathValue("id"))
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Errorf("run %s not found", r.PathValue("id")))
+		return
+	}
+	writeJSON(w, http.StatusOK, s.status(run))
+}
+
+// handleMetrics exposes the metrics of all runs in the Prometheus text format, labelled by run id.
+func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	runs := s.sortedRuns()
+	mw := requestsystem.NewMetricsWriter()
+	for _, run := range runs {
+		run.sim.CollectMetrics(mw, requestsystem.Labels{"run": run.ID})
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	if _, err := mw.WriteTo(w); err != nil {
+		fmt.Println("Error writing metrics:", err)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		fmt.Println("Error writing response:", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, code int, err error) {
+	writeJSON(w, code, map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,146 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestServer serves the API of a server that keeps its runs in a temporary directory.
+func newTestServer(t *testing.T, dir string) (*Server, *httptest.Server) {
+	s := New(dir)
+	ts := httptest.NewServer(s.Handler())
+	t.Cleanup(func() {
+		// Потоки событий завершаются вместе с экспериментами
+		s.Shutdown()
+		ts.Close()
+	})
+	return s, ts
+}
+
+// call sends a request to the API and decodes the JSON response into v, if v is not nil.
+func call(t *testing.T, ts *httptest.Server, method, path, body string, v interface{}) *http.Response {
+	t.Helper()
+	req, err := http.NewRequest(method, ts.URL+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if v != nil {
+		if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+			t.Fatalf("%s %s: %v", method, path, err)
+		}
+	}
+	return resp
+}
+
+func TestStartStatusCancel(t *testing.T) {
+	_, ts := newTestServer(t, t.TempDir())
+
+	var started RunStatus
+	resp := call(t, ts, http.MethodPost, "/runs", `{"duration1": "1h", "duration2": "1h"}`, &started)
+	if resp.StatusCode != http.StatusCreated || resp.Header.Get("Location") != "/runs/1" {
+		t.Fatalf("POST /runs = %d at %q, want 201 at /runs/1", resp.StatusCode, resp.Header.Get("Location"))
+	}
+	if started.ID != "1" || started.Status != StatusRunning || started.Config.BufferCap != 10 {
+		t.Errorf("started run = %+v, want run 1 running with the default buffer_cap", started)
+	}
+
+	var status RunStatus
+	if resp := call(t, ts, http.MethodGet, "/runs/1", "", &status); resp.StatusCode != http.StatusOK || status.Status != StatusRunning {
+		t.Errorf("GET /runs/1 = %d with status %q, want 200 %q", resp.StatusCode, status.Status, StatusRunning)
+	}
+
+	var cancelled RunStatus
+	if resp := call(t, ts, http.MethodDelete, "/runs/1", "", &cancelled); resp.StatusCode != http.StatusOK {
+		t.Fatalf("DELETE /runs/1 = %d, want 200", resp.StatusCode)
+	}
+	if cancelled.Status != StatusCancelled || cancelled.FinishedAt == nil {
+		t.Errorf("cancelled run has status %q and finished_at %v", cancelled.Status, cancelled.FinishedAt)
+	}
+	if _, err := os.Stat(filepath.Join(cancelled.Dir, "report.txt")); err != nil {
+		t.Errorf("cancelled run has no report: %v", err)
+	}
+}
+
+func TestRunCompletes(t *testing.T) {
+	_, ts := newTestServer(t, t.TempDir())
+	call(t, ts, http.MethodPost, "/runs", `{"duration1": "50ms", "duration2": "100ms", "clients_num": 2}`, nil)
+
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		var status RunStatus
+		call(t, ts, http.MethodGet, "/runs/1", "", &status)
+		if status.Status == StatusCompleted {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("run has status %q, want %q", status.Status, StatusCompleted)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	var runs []RunStatus
+	if call(t, ts, http.MethodGet, "/runs", "", &runs); len(runs) != 1 || runs[0].Status != StatusCompleted {
+		t.Errorf("GET /runs = %+v, want the completed run", runs)
+	}
+}
+
+func TestStartErrors(t *testing.T) {
+	// Файл на месте каталога экспериментов не дает создать каталог эксперимента
+	file := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(file, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		dir  string
+		body string
+		want int
+	}{
+		{"malformed JSON", t.TempDir(), `{"buffer_cap":`, http.StatusBadRequest},
+		{"invalid config", t.TempDir(), `{"buffer_cap": 0}`, http.StatusBadRequest},
+		{"run directory cannot be created", file, `{}`, http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, ts := newTestServer(t, tt.dir)
+			var body map[string]string
+			if resp := call(t, ts, http.MethodPost, "/runs", tt.body, &body); resp.StatusCode != tt.want {
+				t.Errorf("POST /runs = %d, want %d", resp.StatusCode, tt.want)
+			}
+			if body["error"] == "" {
+				t.Error("response has no error message")
+			}
+
+			var runs []RunStatus
+			if call(t, ts, http.MethodGet, "/runs", "", &runs); len(runs) != 0 {
+				t.Errorf("failed start left runs %+v", runs)
+			}
+		})
+	}
+}
+
+func TestUnknownRun(t *testing.T) {
+	_, ts := newTestServer(t, t.TempDir())
+	for _, tt := range []struct{ method, path string }{
+		{http.MethodGet, "/runs/7"},
+		{http.MethodDelete, "/runs/7"},
+		{http.MethodGet, "/runs/7/events"},
+	} {
+		var body map[string]string
+		if resp := call(t, ts, tt.method, tt.path, "", &body); resp.StatusCode != http.StatusNotFound || body["error"] != "run 7 not found" {
+			t.Errorf("%s %s = %d %q, want 404 %q", tt.method, tt.path, resp.StatusCode, body["error"], "run 7 not found")
+		}
+	}
+}